@@ -0,0 +1,149 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Aggregate and window functions implemented in Go, see
+// http://www.sqlite.org/c3ref/create_function.html and
+// http://www.sqlite.org/windowfunctions.html for details.
+
+import "os"
+
+// Aggregate SQL function implemented in Go. A fresh value
+// is made for each group; Step() sees the arguments for
+// each row in the group, Final() produces the result. See
+// Function for the Go types of arguments and results.
+type Aggregate interface {
+	Step(args []interface{}) os.Error;
+	Final() (result interface{}, error os.Error);
+}
+
+// Aggregate that can also be used as a window function.
+// Inverse() undoes a Step() for a row leaving the window,
+// Value() produces the result for the current window
+// without ending the group.
+type WindowAggregate interface {
+	Aggregate;
+	Inverse(args []interface{}) os.Error;
+	Value() (result interface{}, error os.Error);
+}
+
+// What we register with SQLite for each aggregate.
+type aggregate struct {
+	factory func() Aggregate;
+}
+
+// Make an aggregate function callable from SQL under the
+// given name. The factory is called to make a new Aggregate
+// for each group. See RegisterFunc() for deterministic.
+func (self *Connection) RegisterAggregate(name string, factory func() Aggregate, deterministic bool) (error os.Error) {
+	flags := sqlUTF8;
+	if deterministic {
+		flags |= sqlDeterministic
+	}
+
+	// if this fails, SQLite releases the id for us
+	id := callbacks.register(&aggregate{factory});
+	rc := self.handle.sqlCreateAggregate(name, -1, flags, id);
+	if rc != StatusOk {
+		error = self.error()
+	}
+	return;
+}
+
+// Make a window function callable from SQL under the given
+// name. It can also be used as a plain aggregate.
+func (self *Connection) RegisterWindow(name string, factory func() WindowAggregate, deterministic bool) (error os.Error) {
+	// SQLite 3.25.0 introduced window functions, see
+	// http://www.sqlite.org/changes.html for details.
+	if sqlVersionNumber() < 3025000 {
+		error = &DriverError{"RegisterWindow: SQLite 3.25.0 or later required!"};
+		return;
+	}
+
+	flags := sqlUTF8;
+	if deterministic {
+		flags |= sqlDeterministic
+	}
+
+	// if this fails, SQLite releases the id for us
+	id := callbacks.register(&aggregate{func() Aggregate { return factory() }});
+	rc := self.handle.sqlCreateWindow(name, -1, flags, id);
+	if rc != StatusOk {
+		error = self.error()
+	}
+	return;
+}
+
+// Aggregate instance for the group SQLite is working on,
+// made on first use. Returns nil if SQLite is out of memory.
+func groupAggregate(id int, context *sqlContext) (instance Aggregate, slot *uintptr) {
+	slot = context.sqlAggregateContext();
+	if slot == nil {
+		return
+	}
+
+	if *slot == 0 {
+		a, ok := callbacks.lookup(id).(*aggregate);
+		if !ok {
+			sqlPanic("unknown aggregate")
+		}
+		instance = a.factory();
+		*slot = uintptr(callbacks.register(instance));
+		return;
+	}
+
+	instance, _ = callbacks.lookup(int(*slot)).(Aggregate);
+	return;
+}
+
+// Called from SQLite for each row entering (or, for window
+// functions, leaving) a group.
+func stepAggregate(id int, context *sqlContext, values []*sqlValue, inverse bool) {
+	defer recoverResult(context);
+
+	instance, _ := groupAggregate(id, context);
+	if instance == nil {
+		context.sqlResultNoMem();
+		return;
+	}
+
+	var error os.Error;
+	if inverse {
+		// SQLite only calls this for window functions
+		error = instance.(WindowAggregate).Inverse(arguments(values))
+	} else {
+		error = instance.Step(arguments(values))
+	}
+	if error != nil {
+		context.sqlResultError(error.String())
+	}
+}
+
+// Called from SQLite for the result of a group. If final,
+// the group is done and we forget about its Aggregate.
+func finishAggregate(id int, context *sqlContext, final bool) {
+	defer recoverResult(context);
+
+	instance, slot := groupAggregate(id, context);
+	if instance == nil {
+		context.sqlResultNoMem();
+		return;
+	}
+
+	var result interface{};
+	var error os.Error;
+	if final {
+		callbacks.unregister(int(*slot));
+		result, error = instance.Final();
+	} else {
+		result, error = instance.(WindowAggregate).Value()
+	}
+
+	if error != nil {
+		context.sqlResultError(error.String());
+		return;
+	}
+	setResult(context, result);
+}
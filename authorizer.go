@@ -0,0 +1,108 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Access control while preparing statements, see
+// http://www.sqlite.org/c3ref/set_authorizer.html for
+// details.
+
+import (
+	"fmt";
+	"os";
+)
+
+// Actions passed to authorizers. The comments list the
+// arguments for each action; the database name and the
+// trigger or view name are passed separately. Insert,
+// Update, and Delete are also used by Change.
+const (
+	ActionCopy		= 0;	// no longer used
+	ActionCreateIndex	= 1;	// index, table
+	ActionCreateTable	= 2;	// table, -
+	ActionCreateTempIndex	= 3;	// index, table
+	ActionCreateTempTable	= 4;	// table, -
+	ActionCreateTempTrigger	= 5;	// trigger, table
+	ActionCreateTempView	= 6;	// view, -
+	ActionCreateTrigger	= 7;	// trigger, table
+	ActionCreateView	= 8;	// view, -
+	ActionDelete		= 9;	// table, -
+	ActionDropIndex		= 10;	// index, table
+	ActionDropTable		= 11;	// table, -
+	ActionDropTempIndex	= 12;	// index, table
+	ActionDropTempTable	= 13;	// table, -
+	ActionDropTempTrigger	= 14;	// trigger, table
+	ActionDropTempView	= 15;	// view, -
+	ActionDropTrigger	= 16;	// trigger, table
+	ActionDropView		= 17;	// view, -
+	ActionInsert		= 18;	// table, -
+	ActionPragma		= 19;	// pragma, argument
+	ActionRead		= 20;	// table, column
+	ActionSelect		= 21;	// -, -
+	ActionTransaction	= 22;	// operation, -
+	ActionUpdate		= 23;	// table, column
+	ActionAttach		= 24;	// file, -
+	ActionDetach		= 25;	// database, -
+	ActionAlterTable	= 26;	// database, table
+	ActionReindex		= 27;	// index, -
+	ActionAnalyze		= 28;	// table, -
+	ActionCreateVTable	= 29;	// table, module
+	ActionDropVTable	= 30;	// table, module
+	ActionFunction		= 31;	// -, function
+	ActionSavepoint		= 32;	// operation, savepoint
+	ActionRecursive		= 33;	// -, -
+)
+
+// Results returned by authorizers.
+const (
+	AuthOk		= iota;	// allow the action
+	AuthDeny;		// fail preparing the statement
+	AuthIgnore;		// treat column as NULL, skip deletes
+)
+
+// Call authorize for each action while statements are
+// prepared. It gets one of the ActionXYZ codes, up to two
+// arguments depending on the action, the database name, and
+// the innermost trigger or view responsible, if any. Missing
+// arguments are "". It returns AuthOk, AuthDeny, or
+// AuthIgnore. Denied actions make Prepare() fail with
+// StatusAuth. Passing nil removes the authorizer.
+func (self *Connection) SetAuthorizer(authorize func(action int, arg1, arg2, db, trigger string) int) (error os.Error) {
+	id := 0;
+	if authorize != nil {
+		id = self.callbackId()
+	}
+
+	rc := self.handle.sqlSetAuthorizer(id);
+	if rc != StatusOk {
+		error = self.error();
+		return;
+	}
+	self.authorizer = authorize;
+	return;
+}
+
+// Called from SQLite for each action.
+func authorize(id int, action int, arg1, arg2, db, trigger string) (result int) {
+	conn, _ := callbacks.lookup(id).(*Connection);
+	// a panic denies, unwinding through C is not an option
+	defer func() {
+		if x := recover(); x != nil {
+			conn.denial = fmt.Sprintf("authorizer panicked: %v", x);
+			result = AuthDeny;
+		}
+	}();
+
+	if conn == nil || conn.authorizer == nil {
+		// the authorizer was removed under us
+		return AuthOk
+	}
+
+	result = conn.authorizer(action, arg1, arg2, db, trigger);
+	if result != AuthOk && result != AuthIgnore {
+		// anything unexpected is a denial, just in case
+		result = AuthDeny
+	}
+	return result;
+}
@@ -0,0 +1,128 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Online backup between connections, see
+// http://www.sqlite.org/backup.html for details.
+
+import (
+	"os";
+	"time";
+)
+
+// Copies a database from one connection to another while
+// the source stays in use. Step() through the backup until
+// it's done, then Close() it; or just call Run().
+type Backup struct {
+	handle	*sqlBackup;
+	dest	*Connection;	// gets all the errors
+}
+
+// Start a backup of database srcName (usually "main") of
+// this connection into database destName of dest. Nothing
+// else should use dest until the backup is closed.
+func (self *Connection) Backup(dest *Connection, srcName, destName string) (backup *Backup, error os.Error) {
+	// SQLite 3.6.11 introduced the backup API, see
+	// http://www.sqlite.org/changes.html for details.
+	if sqlVersionNumber() < 3006011 {
+		error = &DriverError{"Backup: SQLite 3.6.11 or later required!"};
+		return;
+	}
+
+	handle := dest.handle.sqlBackupInit(destName, self.handle, srcName);
+	if handle == nil {
+		error = dest.error();
+		return;
+	}
+
+	backup = &Backup{handle, dest};
+	return;
+}
+
+// Copy up to the given number of pages, all remaining pages
+// if negative. Returns true once the backup is complete. If
+// the source or destination are locked, a SystemError with
+// StatusBusy or StatusLocked is returned and it's fine to
+// try again later.
+func (self *Backup) Step(pages int) (done bool, error os.Error) {
+	rc := self.handle.sqlBackupStep(pages);
+	switch rc & 0xff {
+	case StatusOk:
+	case StatusDone:
+		done = true
+	default:
+		// backup errors don't always show up in the
+		// connection, so we make our own SystemError
+		e := new(SystemError);
+		e.basic = rc & 0xff;
+		e.extended = rc;
+		e.message = "backup step failed";
+		error = e;
+	}
+	return;
+}
+
+// Number of pages left to copy as of the last Step().
+func (self *Backup) Remaining() int	{ return self.handle.sqlBackupRemaining() }
+
+// Number of pages in the source as of the last Step().
+func (self *Backup) PageCount() int	{ return self.handle.sqlBackupPageCount() }
+
+// Release all resources associated with the backup. Returns
+// the error that ended the backup prematurely, if any.
+func (self *Backup) Close() (error os.Error) {
+	rc := self.handle.sqlBackupFinish();
+	if rc != StatusOk {
+		error = self.dest.error()
+	}
+	self.handle = nil;
+	self.dest = nil;
+	return;
+}
+
+// Step through the whole backup copying the given number of
+// pages at a time, sleeping for the given number of
+// nanoseconds whenever the source or destination are locked.
+// After each step progress (if not nil) is called with the
+// number of pages remaining and the total number of pages.
+// The backup is closed when Run() returns.
+func (self *Backup) Run(pages int, sleep int64, progress func(remaining, total int)) (error os.Error) {
+	return self.RunCancel(nil, pages, sleep, progress)
+}
+
+// Same as Run() but gives up with ErrCancelled once the
+// cancel channel fires, checked before each step. Without
+// a cancel channel, a source that stays locked makes Run()
+// wait forever.
+func (self *Backup) RunCancel(cancel <-chan bool, pages int, sleep int64, progress func(remaining, total int)) (error os.Error) {
+	for {
+		if fired(cancel) {
+			error = ErrCancelled;
+			break;
+		}
+		done, e := self.Step(pages);
+		if e != nil {
+			basic := e.(*SystemError).Basic();
+			if basic != StatusBusy && basic != StatusLocked {
+				error = e;
+				break;
+			}
+			time.Sleep(sleep);
+			continue;
+		}
+		if progress != nil {
+			progress(self.Remaining(), self.PageCount())
+		}
+		if done {
+			break
+		}
+	}
+
+	e := self.Close();
+	if error == nil {
+		error = e
+	}
+	return;
+}
@@ -0,0 +1,194 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+import (
+	"fmt";
+	"os";
+	"reflect";
+)
+
+// Passing a ZeroBlob as a parameter binds a BLOB of the
+// given size that is filled with zeros. Useful to reserve
+// space that is written incrementally later.
+type ZeroBlob int
+
+// largest unsigned value we can bind without wrapping
+const maxInt64 = 1<<63 - 1
+
+// Bind a Go value to the given parameter slot (counting
+// from 0) using the SQLite type closest to its Go type.
+// Integers bind as INTEGER, floats as REAL, strings as
+// TEXT, []byte as BLOB, and nil as NULL. Booleans bind
+// as 0 and 1 since SQLite has no boolean type.
+func (self *Statement) bind(slot int, value interface{}) (error os.Error) {
+	var rc int;
+
+	switch v := value.(type) {
+	case nil:
+		rc = self.handle.sqlBindNull(slot)
+	case int:
+		rc = self.handle.sqlBindInt64(slot, int64(v))
+	case int8:
+		rc = self.handle.sqlBindInt64(slot, int64(v))
+	case int16:
+		rc = self.handle.sqlBindInt64(slot, int64(v))
+	case int32:
+		rc = self.handle.sqlBindInt64(slot, int64(v))
+	case int64:
+		rc = self.handle.sqlBindInt64(slot, v)
+	case uint:
+		// as big as uint64 on 64-bit platforms
+		if uint64(v) > maxInt64 {
+			error = &DriverError{fmt.Sprintf("Execute: parameter %d overflows int64", slot+1)};
+			return;
+		}
+		rc = self.handle.sqlBindInt64(slot, int64(v));
+	case uint8:
+		rc = self.handle.sqlBindInt64(slot, int64(v))
+	case uint16:
+		rc = self.handle.sqlBindInt64(slot, int64(v))
+	case uint32:
+		rc = self.handle.sqlBindInt64(slot, int64(v))
+	case uint64:
+		if v > maxInt64 {
+			error = &DriverError{fmt.Sprintf("Execute: parameter %d overflows int64", slot+1)};
+			return;
+		}
+		rc = self.handle.sqlBindInt64(slot, int64(v));
+	case float:
+		rc = self.handle.sqlBindDouble(slot, float64(v))
+	case float32:
+		rc = self.handle.sqlBindDouble(slot, float64(v))
+	case float64:
+		rc = self.handle.sqlBindDouble(slot, v)
+	case bool:
+		rc = self.handle.sqlBindInt64(slot, map[bool]int64{true: 1, false: 0}[v])
+	case string:
+		rc = self.handle.sqlBindText(slot, v)
+	case []byte:
+		rc = self.handle.sqlBindBlob(slot, v)
+	case ZeroBlob:
+		rc = self.handle.sqlBindZeroBlob(slot, int(v))
+	default:
+		error = &DriverError{fmt.Sprintf("Execute: can't bind parameter %d of type %T", slot+1, value)};
+		return;
+	}
+
+	if rc != StatusOk {
+		error = self.connection.error()
+	}
+	return;
+}
+
+// Bind the parameters passed to Execute(). A single map or
+// struct (or pointer to struct) is bound by name, anything
+// else is bound by position.
+func (self *Statement) bindParameters(parameters []interface{}) (error os.Error) {
+	if len(parameters) == 1 {
+		values, ok := namedValues(parameters[0]);
+		if ok {
+			return self.bindNamed(values)
+		}
+	}
+
+	if len(parameters) != self.handle.sqlBindParameterCount() {
+		error = &DriverError{"Execute: Number of parameters doesn't match!"};
+		return;
+	}
+
+	for k, v := range parameters {
+		error = self.bind(k, v);
+		if error != nil {
+			return
+		}
+	}
+	return;
+}
+
+// Bind named parameters. SQLite keeps the ":", "@", or "$"
+// prefix as part of the name; keys may include it to pick
+// one in particular, otherwise we try all three. Every slot
+// in the statement must get a value and every value must
+// find a slot.
+func (self *Statement) bindNamed(values map[string]interface{}) (error os.Error) {
+	count := self.handle.sqlBindParameterCount();
+	bound := make([]bool, count);
+
+	for name, value := range values {
+		slot := self.parameterIndex(name);
+		if slot < 0 {
+			error = &DriverError{fmt.Sprintf("Execute: unknown parameter %s", name)};
+			return;
+		}
+		error = self.bind(slot, value);
+		if error != nil {
+			return
+		}
+		bound[slot] = true;
+	}
+
+	for slot := 0; slot < count; slot++ {
+		if bound[slot] {
+			continue
+		}
+		name := self.handle.sqlBindParameterName(slot);
+		if len(name) == 0 || name[0] == '?' {
+			error = &DriverError{fmt.Sprintf("Execute: positional parameter %d can't be bound by name", slot+1)}
+		} else {
+			error = &DriverError{fmt.Sprintf("Execute: no value for parameter %s", name)}
+		}
+		return;
+	}
+
+	return;
+}
+
+// Slot for the given parameter name, -1 if there is none.
+func (self *Statement) parameterIndex(name string) int {
+	if len(name) > 0 && isParameterPrefix(name[0]) {
+		return self.handle.sqlBindParameterIndex(name)
+	}
+	for _, prefix := range []string{":", "@", "$"} {
+		slot := self.handle.sqlBindParameterIndex(prefix + name);
+		if slot >= 0 {
+			return slot
+		}
+	}
+	return -1;
+}
+
+func isParameterPrefix(c byte) bool	{ return c == ':' || c == '@' || c == '$' }
+
+// Extract named values from a map[string]interface{} or a
+// struct. Struct fields are named by their tag if they have
+// one, by their field name otherwise.
+func namedValues(value interface{}) (values map[string]interface{}, ok bool) {
+	if m, isMap := value.(map[string]interface{}); isMap {
+		return m, true
+	}
+
+	v := reflect.NewValue(value);
+	if p, isPtr := v.(*reflect.PtrValue); isPtr {
+		v = p.Elem()
+	}
+	s, isStruct := v.(*reflect.StructValue);
+	if !isStruct {
+		return
+	}
+
+	t := s.Type().(*reflect.StructType);
+	values = make(map[string]interface{}, s.NumField());
+	for i := 0; i < s.NumField(); i++ {
+		f := t.Field(i);
+		name := f.Tag;
+		if len(name) == 0 {
+			name = f.Name
+		}
+		values[name] = getField(s, i).Interface();
+	}
+	ok = true;
+	return;
+}
@@ -0,0 +1,155 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Incremental I/O on BLOBs, see
+// http://www.sqlite.org/c3ref/blob_open.html for details.
+
+import (
+	"fmt";
+	"os";
+)
+
+// A single BLOB (or TEXT) value in the database, opened
+// for reading and possibly writing. Implements io.Reader,
+// io.Writer, io.Seeker, io.ReaderAt, and io.Closer. The
+// size of a Blob is fixed, use ZeroBlob parameters to
+// reserve space before writing. If the row changes under
+// us, all further operations fail.
+type Blob struct {
+	handle		*sqlBlob;
+	connection	*Connection;
+	size		int64;
+	offset		int64;	// for Read(), Write(), Seek()
+}
+
+// Open the value in the given column of the given row. The
+// db is the name of the database, usually "main".
+func (self *Connection) OpenBlob(db, table, column string, rowid int64, writable bool) (blob *Blob, error os.Error) {
+	handle, rc := self.handle.sqlBlobOpen(db, table, column, rowid, writable);
+	if rc != StatusOk {
+		error = self.error();
+		return;
+	}
+
+	blob = &Blob{handle, self, int64(handle.sqlBlobBytes()), 0};
+	return;
+}
+
+// Size of the BLOB in bytes.
+func (self *Blob) Size() int64	{ return self.size }
+
+// Move to the same column of another row. The offset is
+// reset to 0. If this fails, the Blob can only be closed.
+func (self *Blob) Reopen(rowid int64) (error os.Error) {
+	// SQLite 3.7.4 introduced sqlite3_blob_reopen(), see
+	// http://www.sqlite.org/changes.html for details.
+	if sqlVersionNumber() < 3007004 {
+		error = &DriverError{"Reopen: SQLite 3.7.4 or later required!"};
+		return;
+	}
+
+	rc := self.handle.sqlBlobReopen(rowid);
+	if rc != StatusOk {
+		error = self.connection.error();
+		return;
+	}
+	self.size = int64(self.handle.sqlBlobBytes());
+	self.offset = 0;
+	return;
+}
+
+// Implements io.Reader interface.
+func (self *Blob) Read(p []byte) (n int, error os.Error) {
+	n, error = self.ReadAt(p, self.offset);
+	self.offset += int64(n);
+	if error == os.EOF && n > 0 {
+		// report EOF on the next call
+		error = nil
+	}
+	return;
+}
+
+// Implements io.ReaderAt interface.
+func (self *Blob) ReadAt(p []byte, offset int64) (n int, error os.Error) {
+	if offset < 0 {
+		error = &DriverError{"ReadAt: negative offset"};
+		return;
+	}
+	if offset >= self.size {
+		error = os.EOF;
+		return;
+	}
+
+	n = len(p);
+	if int64(n) > self.size-offset {
+		n = int(self.size - offset);
+		error = os.EOF;
+	}
+
+	rc := self.handle.sqlBlobRead(p[0:n], int(offset));
+	if rc != StatusOk {
+		n = 0;
+		error = self.connection.error();
+	}
+	return;
+}
+
+// Implements io.Writer interface. Writing past the end of
+// the BLOB writes as much as fits and returns an error.
+func (self *Blob) Write(p []byte) (n int, error os.Error) {
+	n = len(p);
+	if int64(n) > self.size-self.offset {
+		n = int(self.size - self.offset);
+		if n < 0 {
+			n = 0
+		}
+		error = &DriverError{fmt.Sprintf("Write: can't grow BLOB beyond %d bytes", self.size)};
+	}
+
+	rc := self.handle.sqlBlobWrite(p[0:n], int(self.offset));
+	if rc != StatusOk {
+		n = 0;
+		error = self.connection.error();
+		return;
+	}
+	self.offset += int64(n);
+	return;
+}
+
+// Implements io.Seeker interface. Seeking past the end is
+// fine, reads and writes there will fail.
+func (self *Blob) Seek(offset int64, whence int) (ret int64, error os.Error) {
+	switch whence {
+	case 0:
+		ret = offset
+	case 1:
+		ret = self.offset + offset
+	case 2:
+		ret = self.size + offset
+	default:
+		error = &DriverError{"Seek: invalid whence"};
+		return;
+	}
+
+	if ret < 0 {
+		error = &DriverError{"Seek: negative position"};
+		return;
+	}
+	self.offset = ret;
+	return;
+}
+
+// Implements io.Closer interface. After a call to Close()
+// the Blob can not be used anymore.
+func (self *Blob) Close() (error os.Error) {
+	rc := self.handle.sqlBlobClose();
+	if rc != StatusOk {
+		error = self.connection.error()
+	}
+	self.handle = nil;
+	self.connection = nil;
+	return;
+}
@@ -0,0 +1,96 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Operations that may run for a long time have XYZCancel()
+// variants that take a cancel channel. A goroutine watches
+// that channel while SQLite works and interrupts the
+// connection if it fires, see
+// http://www.sqlite.org/c3ref/interrupt.html for details.
+
+import "sync"
+
+type watcher struct {
+	connection	*Connection;
+	cancel		<-chan bool;
+	done		chan bool;	// tells goroutine to quit
+	early		bool;		// fired before we started
+	lock		sync.Mutex;	// protects the fields below
+	finished	bool;		// SQLite call returned
+	fired		bool;		// we interrupted SQLite
+}
+
+// Abort any pending operation on the connection as soon
+// as possible. The operation fails with a SystemError
+// with basic status code StatusInterrupt. It's safe to
+// call Interrupt() from another goroutine.
+func (self *Connection) Interrupt()	{ self.handle.sqlInterrupt() }
+
+// Start watching the cancel channel, which may be nil if
+// there's nothing to watch.
+func (self *Connection) watch(cancel <-chan bool) (w *watcher) {
+	w = new(watcher);
+	w.connection = self;
+	if cancel == nil {
+		return
+	}
+
+	// no need to bother SQLite if we're cancelled already
+	if fired(cancel) {
+		w.early = true;
+		return;
+	}
+
+	w.cancel = cancel;
+	w.done = make(chan bool, 1);
+	go w.run();
+	return;
+}
+
+// Has the cancel channel fired yet? Doesn't block, and a
+// nil channel never fires.
+func fired(cancel <-chan bool) bool {
+	if cancel == nil {
+		return false
+	}
+	select {
+	case _ = <-cancel:
+		return true
+	default:
+	}
+	return false;
+}
+
+// goroutine waiting for either cancel or done
+func (self *watcher) run() {
+	select {
+	case _ = <-self.cancel:
+		self.lock.Lock();
+		// don't interrupt whatever comes after us
+		if !self.finished {
+			self.fired = true;
+			self.connection.Interrupt();
+		}
+		self.lock.Unlock();
+	case _ = <-self.done:
+	}
+}
+
+// Did the cancel channel fire before we even started?
+func (self *watcher) cancelled() bool	{ return self.early }
+
+// Stop watching; returns true if we interrupted SQLite.
+func (self *watcher) stop() (fired bool) {
+	if self.cancel == nil {
+		return
+	}
+	self.lock.Lock();
+	self.finished = true;
+	fired = self.fired;
+	self.lock.Unlock();
+	// buffered, so this never blocks
+	self.done <- true;
+	return;
+}
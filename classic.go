@@ -32,7 +32,7 @@ func struct2array(s *reflect.StructValue) (r []interface{}) {
 	l := s.NumField();
 	r = make([]interface{}, l);
 	for i := 0; i < l; i++ {
-		r[i] = getField(s, i)
+		r[i] = getField(s, i).Interface()
 	}
 	return;
 }
@@ -41,6 +41,13 @@ func struct2array(s *reflect.StructValue) (r []interface{}) {
 // (if any). The statement stays valid even if we fail
 // to execute with given parameters.
 func (self *Connection) ExecuteClassic(statement db.Statement, parameters ...) (rset db.ClassicResultSet, error os.Error) {
+	return self.ExecuteClassicCancel(nil, statement, parameters)
+}
+
+// Same as ExecuteClassic() but gives up with ErrCancelled
+// once the cancel channel fires (receives a value or gets
+// closed).
+func (self *Connection) ExecuteClassicCancel(cancel <-chan bool, statement db.Statement, parameters ...) (rset db.ClassicResultSet, error os.Error) {
 	s, ok := statement.(*Statement);
 	if !ok {
 		error = &DriverError{"Execute: Not an sqlite3 statement!"};
@@ -49,30 +56,14 @@ func (self *Connection) ExecuteClassic(statement db.Statement, parameters ...) (
 
 	p := reflect.NewValue(parameters).(*reflect.StructValue);
 
-	if p.NumField() != s.handle.sqlBindParameterCount() {
-		error = &DriverError{"Execute: Number of parameters doesn't match!"};
+	error = s.bindParameters(struct2array(p));
+	if error != nil {
+		s.clear();
 		return;
 	}
 
-	pa := struct2array(p);
-
-	for k, v := range pa {
-		q := v.(*reflect.StringValue).Get();
-		rc := s.handle.sqlBindText(k, q);
-
-		if rc != StatusOk {
-			error = self.error();
-			s.clear();
-			return;
-		}
-	}
-
-	rc := s.handle.sqlStep();
-
-	if rc != StatusDone && rc != StatusRow {
-		// presumably any other outcome is an error
-		error = self.error()
-	}
+	var rc int;
+	rc, error = s.step(cancel);
 
 	if rc == StatusRow {
 		// statement is producing results, need a cursor
@@ -105,6 +96,13 @@ func (self *ClassicResultSet) More() bool {
 // the statement that produced them will be reset and
 // ready for another execution.
 func (self *ClassicResultSet) Fetch() (result db.Result) {
+	return self.FetchCancel(nil)
+}
+
+// Same as Fetch() but gives up with ErrCancelled once the
+// cancel channel fires. A cancelled result set is done,
+// there's no way to resume it.
+func (self *ClassicResultSet) FetchCancel(cancel <-chan bool) (result db.Result) {
 	res := new(Result);
 	result = res;
 
@@ -121,19 +119,15 @@ func (self *ClassicResultSet) Fetch() (result db.Result) {
 	}
 	res.data = make([]interface{}, nColumns);
 	for i := 0; i < nColumns; i++ {
-		res.data[i] = self.statement.handle.sqlColumnText(i);
+		res.data[i] = self.statement.column(i);
 	}
 
 	// try to get another row
-	rc := self.statement.handle.sqlStep();
-
-	if rc != StatusDone && rc != StatusRow {
-		// presumably any other outcome is an error
-		// TODO: is res.error the right place?
-		res.error = self.connection.error()
-	}
+	// TODO: is res.error the right place?
+	var rc int;
+	rc, res.error = self.statement.step(cancel);
 
-	if rc == StatusDone {
+	if rc == StatusDone || res.error == ErrCancelled {
 		self.more = false;
 		// clean up when done
 		self.statement.clear();
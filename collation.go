@@ -0,0 +1,178 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Collations implemented in Go, see
+// http://www.sqlite.org/c3ref/create_collation.html for
+// details.
+
+import (
+	"os";
+	"unicode";
+	"utf8";
+)
+
+// Make compare available as a collation under the given
+// name, for use in COLLATE clauses and indexes. It returns
+// a negative number, zero, or a positive number if a is
+// less than, equal to, or greater than b. Passing nil
+// removes a collation.
+func (self *Connection) RegisterCollation(name string, compare func(a, b string) int) (error os.Error) {
+	id := 0;
+	if compare != nil {
+		// if this fails, SQLite releases the id for us
+		id = callbacks.register(compare)
+	}
+
+	rc := self.handle.sqlCreateCollation(name, id);
+	if rc != StatusOk {
+		error = self.error()
+	}
+	return;
+}
+
+// Call needed whenever SQLite runs into a collation that
+// is not registered yet. It can call RegisterCollation()
+// to provide the collation just in time. Passing nil
+// removes the callback.
+func (self *Connection) OnCollationNeeded(needed func(conn *Connection, name string)) (error os.Error) {
+	id := 0;
+	if needed != nil {
+		id = self.callbackId()
+	}
+
+	rc := self.handle.sqlCollationNeeded(id);
+	if rc != StatusOk {
+		error = self.error();
+		return;
+	}
+	self.collationNeeded = needed;
+	return;
+}
+
+// Called from SQLite to compare strings.
+func callCollation(id int, a, b string) (result int) {
+	// Collations can't report errors and unwinding through
+	// C is not an option, so after a panic we make do with
+	// plain byte order.
+	defer func() {
+		if x := recover(); x != nil {
+			result = binaryCompare(a, b)
+		}
+	}();
+
+	compare, ok := callbacks.lookup(id).(func(a, b string) int);
+	if !ok {
+		sqlPanic("unknown collation")
+	}
+	return compare(a, b);
+}
+
+// Byte order, same as SQLite's BINARY collation.
+func binaryCompare(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0;
+}
+
+// Called from SQLite for unknown collations. A panic leaves
+// the collation unregistered, so the statement fails.
+func collationNeeded(id int, name string) {
+	defer recoverCallback();
+
+	conn, ok := callbacks.lookup(id).(*Connection);
+	if !ok || conn.collationNeeded == nil {
+		// the callback was removed under us
+		return
+	}
+	conn.collationNeeded(conn, name);
+}
+
+// Collation comparing strings character by character after
+// folding them to lower case, using Unicode case mapping
+// instead of the ASCII-only NOCASE collation.
+func FoldCompare(a, b string) int {
+	i, j := 0, 0;
+	for i < len(a) && j < len(b) {
+		ra, na := utf8.DecodeRuneInString(a[i:len(a)]);
+		rb, nb := utf8.DecodeRuneInString(b[j:len(b)]);
+		if c := compareInts(unicode.ToLower(ra), unicode.ToLower(rb)); c != 0 {
+			return c
+		}
+		i += na;
+		j += nb;
+	}
+	return compareInts(len(a)-i, len(b)-j);
+}
+
+// Collation comparing runs of digits by numeric value and
+// everything else character by character, so "file2" sorts
+// before "file10". If strings only differ in leading zeros,
+// fewer zeros come first.
+func NaturalCompare(a, b string) int {
+	i, j := 0, 0;
+	zeros := 0;	// tie breaker for leading zeros
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			si, sj := i, j;
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			x, y := trimZeros(a[si:i]), trimZeros(b[sj:j]);
+			if c := compareInts(len(x), len(y)); c != 0 {
+				return c
+			}
+			if x != y {
+				if x < y {
+					return -1
+				}
+				return 1;
+			}
+			if zeros == 0 {
+				zeros = compareInts(i-si, j-sj)
+			}
+			continue;
+		}
+
+		ra, na := utf8.DecodeRuneInString(a[i:len(a)]);
+		rb, nb := utf8.DecodeRuneInString(b[j:len(b)]);
+		if c := compareInts(ra, rb); c != 0 {
+			return c
+		}
+		i += na;
+		j += nb;
+	}
+	if c := compareInts(len(a)-i, len(b)-j); c != 0 {
+		return c
+	}
+	return zeros;
+}
+
+func isDigit(c byte) bool	{ return '0' <= c && c <= '9' }
+
+func trimZeros(s string) string {
+	i := 0;
+	for i < len(s)-1 && s[i] == '0' {
+		i++
+	}
+	return s[i:len(s)];
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0;
+}
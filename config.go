@@ -0,0 +1,188 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+import (
+	"fmt";
+	"os";
+	"strconv";
+	"strings";
+)
+
+// Everything OpenWithConfig() needs to know to open a
+// connection. The zero value of each field gives the same
+// behavior as Open() without that option.
+type OpenConfig struct {
+	// Path or name of the database; URL: the path
+	Path	string;
+	// OpenXYZ flags or'd together; URL option "flags"
+	Flags	int;
+	// Name of the VFS to use; URL option "vfs"
+	Vfs	string;
+	// Milliseconds to retry when the database is locked;
+	// 0 means the default of 16 seconds; URL option
+	// "busy_timeout"
+	BusyTimeout	int;
+	// Don't retry at all when the database is locked;
+	// URL option "busy_timeout=0"
+	NoBusyTimeout	bool;
+	// Pragmas to run right after opening, in order; see
+	// urlPragmas for those available as URL options.
+	// Opening fails if journal_mode or locking_mode don't
+	// take effect.
+	Pragmas	[]Pragma;
+	// "shared", "private", or "" for SQLite's default;
+	// URL option "cache"
+	CacheMode	string;
+	// Report basic status codes only; see SystemError
+	NoExtendedCodes	bool;
+	// Hooks to register right after opening, see
+	// OnUpdate(), OnCommit(), and OnRollback()
+	OnUpdate	func(op, db, table string, rowid int64);
+	OnCommit	func() bool;
+	OnRollback	func();
+}
+
+// A pragma to run as "PRAGMA Name = Value", see
+// http://www.sqlite.org/pragma.html for details.
+type Pragma struct {
+	Name, Value string;
+}
+
+// Make sure the config makes sense before we open anything.
+func (self *OpenConfig) check() (error os.Error) {
+	if len(self.Path) == 0 {
+		return &DriverError{"Open: no path or database name"}
+	}
+	if self.BusyTimeout < 0 {
+		return &DriverError{fmt.Sprintf("Open: negative busy timeout %d", self.BusyTimeout)}
+	}
+
+	switch self.CacheMode {
+	case "", "shared", "private":
+	default:
+		return &DriverError{fmt.Sprintf("Open: unknown cache mode %s", self.CacheMode)}
+	}
+
+	for _, p := range self.Pragmas {
+		if !isName(p.Name) {
+			return &DriverError{fmt.Sprintf("Open: bad pragma name %q", p.Name)}
+		}
+		if !isPragmaValue(p.Value) {
+			return &DriverError{fmt.Sprintf("Open: bad value %q for pragma %s", p.Value, p.Name)}
+		}
+	}
+	return;
+}
+
+// Names of pragmas: letters, digits, and underscores only,
+// optionally prefixed with a database name.
+func isName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isWordChar(name[i]) && name[i] != '.' {
+			return false
+		}
+	}
+	return true;
+}
+
+// Values of pragmas: a keyword or a number, optionally
+// signed, or a string literal. Anything else might sneak
+// more SQL in after the pragma.
+func isPragmaValue(value string) bool {
+	if len(value) > 0 && value[0] == '\'' {
+		return isStringLiteral(value)
+	}
+	if len(value) > 0 && (value[0] == '-' || value[0] == '+') {
+		value = value[1:len(value)]
+	}
+	return isName(value);
+}
+
+// A single-quoted SQL string, '' standing for a quote.
+func isStringLiteral(value string) bool {
+	n := len(value);
+	if n < 2 || value[0] != '\'' || value[n-1] != '\'' {
+		return false
+	}
+	for i := 1; i < n-1; i++ {
+		if value[i] == '\'' {
+			// must be doubled, and not by the closing quote
+			if i+1 >= n-1 || value[i+1] != '\'' {
+				return false
+			}
+			i++;
+		}
+	}
+	return true;
+}
+
+// Pragmas that can be passed as options in the URL for
+// Open(), in the order we run them: locking_mode has to
+// come before journal_mode so WAL works with exclusive
+// locking, and synchronous after journal_mode since its
+// best setting depends on the journal. Values is nil for
+// pragmas taking integers.
+type urlPragma struct {
+	name	string;
+	values	[]string;
+}
+
+var urlPragmas = []urlPragma{
+	urlPragma{"locking_mode", []string{"normal", "exclusive"}},
+	urlPragma{"journal_mode", []string{"delete", "truncate", "persist", "memory", "wal", "off"}},
+	urlPragma{"synchronous", []string{"off", "normal", "full", "extra", "0", "1", "2", "3"}},
+	urlPragma{"cache_size", nil},
+	urlPragma{"mmap_size", nil},
+	urlPragma{"temp_store", []string{"default", "file", "memory", "0", "1", "2"}},
+	urlPragma{"foreign_keys", []string{"on", "off", "true", "false", "yes", "no", "1", "0"}},
+}
+
+// Is this option a pragma we accept in URLs?
+func isURLPragma(name string) bool {
+	for _, p := range urlPragmas {
+		if p.name == name {
+			return true
+		}
+	}
+	return false;
+}
+
+// Turn pragma options from a URL into Pragmas in the order
+// given by urlPragmas, checking their values on the way.
+func urlPragmaList(options map[string]string) (pragmas []Pragma, error os.Error) {
+	pragmas = make([]Pragma, 0, len(options));
+	for _, p := range urlPragmas {
+		value, ok := options[p.name];
+		if !ok {
+			continue
+		}
+		value = strings.ToLower(value);
+		if !p.valid(value) {
+			error = &DriverError{fmt.Sprintf("Open: bad value %q for option %s", value, p.name)};
+			return;
+		}
+		n := len(pragmas);
+		pragmas = pragmas[0 : n+1];
+		pragmas[n] = Pragma{p.name, value};
+	}
+	return;
+}
+
+func (self *urlPragma) valid(value string) bool {
+	if self.values == nil {
+		_, e := strconv.Atoi64(value);
+		return e == nil;
+	}
+	for _, v := range self.values {
+		if v == value {
+			return true
+		}
+	}
+	return false;
+}
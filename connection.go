@@ -11,7 +11,21 @@ import (
 
 // SQLite connections
 type Connection struct {
-	handle *sqlConnection;
+	handle		*sqlConnection;
+	id		int;		// for callbacks, 0 if none yet
+	savepoints	[]*Savepoint;	// innermost last
+	savepointCount	int;		// for unique names
+	// callbacks, nil if not set
+	collationNeeded	func(*Connection, string);
+	onUpdate	func(string, string, string, int64);
+	onCommit	func() bool;
+	onRollback	func();
+	authorizer	func(int, string, string, string, string) int;
+	denial		string;	// why the policy denied the last prepare
+	tracer		func(TraceEvent);
+	traceMask	int;
+	slowLog		*slowLog;
+	feed		*ChangeFeed;
 }
 
 // Fill in a SystemError with information about
@@ -31,13 +45,35 @@ func (self *Connection) error() (error os.Error) {
 
 // Precompile query into Statement.
 func (self *Connection) Prepare(query string) (statement db.Statement, error os.Error) {
+	return self.PrepareCancel(nil, query)
+}
+
+// Same as Prepare() but gives up with ErrCancelled once the
+// cancel channel fires.
+func (self *Connection) PrepareCancel(cancel <-chan bool, query string) (statement db.Statement, error os.Error) {
+	w := self.watch(cancel);
+	if w.cancelled() {
+		error = ErrCancelled;
+		return;
+	}
+
 	s := new(Statement);
 	s.connection = self;
 	var rc int;
-	s.handle, rc = self.handle.sqlPrepare(query)
+	self.denial = "";
+	s.handle, rc = self.handle.sqlPrepare(query);
+	cancelled := w.stop();
 
-	if rc != StatusOk {
-		error = self.error();
+	// even if SQLite was done before the interrupt came in
+	if cancelled || rc != StatusOk {
+		switch {
+		case cancelled:
+			error = ErrCancelled
+		case rc&0xff == StatusAuth && len(self.denial) > 0:
+			error = &DriverError{"Prepare: " + self.denial}
+		default:
+			error = self.error()
+		}
 		// did we get a handle anyway? if so we need to
 		// finalize it, but that could trigger another,
 		// secondary error; for now we ignore that one;
@@ -53,16 +89,56 @@ func (self *Connection) Prepare(query string) (statement db.Statement, error os.
 	return;
 }
 
+// Run a single statement that takes no parameters and
+// whose results, if any, we don't care about. Used for
+// the SQL behind transactions and the like.
+func (self *Connection) exec(query string) (error os.Error) {
+	_, error = self.execText(query);
+	return;
+}
+
+// Same as exec() but returns the first column of the first
+// row as text, "" if there's none. Used for pragmas that
+// report what they did.
+func (self *Connection) execText(query string) (result string, error os.Error) {
+	s, rc := self.handle.sqlPrepare(query);
+	if rc != StatusOk {
+		error = self.error();
+		return;
+	}
+
+	mark := self.changeMark();
+	rc = s.sqlStep();
+	switch {
+	case rc == StatusRow && s.sqlColumnCount() > 0:
+		result = s.sqlColumnText(0)
+	case rc != StatusDone && rc != StatusRow:
+		// grab the error before finalizing, just in case
+		error = self.error();
+		self.undoChanges(mark);
+	}
+	self.stepped();
 
+	// any error from finalize repeats the one from step
+	_ = s.sqlFinalize();
+	return;
+}
 
 func (self *Connection) Execute(statement db.Statement, parameters ...) (rs db.ResultSet, error os.Error) {
+	return self.ExecuteCancel(nil, statement, parameters)
+}
+
+// Same as Execute() but gives up with ErrCancelled once the
+// cancel channel fires, either while executing or later
+// while iterating over results.
+func (self *Connection) ExecuteCancel(cancel <-chan bool, statement db.Statement, parameters ...) (rs db.ResultSet, error os.Error) {
 	var crs db.ClassicResultSet;
-	crs, error = self.ExecuteClassic(statement, parameters);
+	crs, error = self.ExecuteClassicCancel(cancel, statement, parameters);
 	if error != nil {
 		return
 	}
 	mrs := new(ResultSet);
-	mrs.init(crs);
+	mrs.init(crs, cancel);
 	rs = mrs;
 	return;
 }
@@ -71,11 +147,36 @@ func (self *Connection) Close() (error os.Error) {
 	// TODO
 	rc := self.handle.sqlClose();
 	if rc != StatusOk {
-		error = self.error()
+		error = self.error();
+		return;
+	}
+	if self.feed != nil {
+		self.feed.shut()
+	}
+	if self.id != 0 {
+		callbacks.unregister(self.id);
+		self.id = 0;
 	}
 	return;
 }
 
+// Called after SQLite did some work that may have ended a
+// transaction.
+func (self *Connection) stepped() {
+	if self.feed != nil {
+		self.feed.settle()
+	}
+}
+
+// Id under which callbacks from SQLite find the connection.
+// We only register connections that actually need it.
+func (self *Connection) callbackId() int {
+	if self.id == 0 {
+		self.id = callbacks.register(self)
+	}
+	return self.id;
+}
+
 func (self *Connection) Changes() (changes int, error os.Error) {
 	changes = self.handle.sqlChanges();
 	return;
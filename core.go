@@ -10,13 +10,17 @@ import (
 	"http";
 	"os";
 	"strconv";
+	"strings";
+	"sync";
 )
 
 // These constants can be or'd together and passed as the
 // "flags" option to Open(). Some of them only apply if
 // the "vfs" option is also passed. See SQLite documentation
-// for details. Note that we always force OpenFullMutex,
-// so passing OpenNoMutex has no effect. See also FlagURL().
+// for details. In serialized threading mode we add
+// OpenFullMutex unless OpenNoMutex is passed; in other
+// modes connections have no mutex unless you pass
+// OpenFullMutex yourself. See also FlagURL() and Configure().
 const (
 	OpenReadOnly		= 0x00000001;
 	OpenReadWrite		= 0x00000002;
@@ -37,8 +41,8 @@ const (
 )
 
 // Constants for sqlite3_config() used only internally.
-// In fact only *one* is used. See SQLite documentation
-// for details.
+// Only the threading modes are used, see Configure().
+// See SQLite documentation for details.
 const (
 	_	= iota;
 	configSingleThread;
@@ -58,6 +62,14 @@ const (
 	configGetPCache;
 )
 
+// Threading modes for Configure(), see
+// http://www.sqlite.org/threadsafe.html for details.
+const (
+	ThreadSingle		= configSingleThread;	// no mutexes at all
+	ThreadMulti		= configMultiThread;	// connections not shared
+	ThreadSerialized	= configSerialized;	// connections shared
+)
+
 // after we run into a locked database/table,
 // we'll retry for this long
 const defaultTimeoutMilliseconds = 16 * 1000
@@ -72,13 +84,75 @@ func init() {
 	// to the database API for functions as well.
 	Version = version;
 	Open = open;
+}
+
+// The threading mode can only be chosen before SQLite is
+// initialized, which happens when we open the first
+// connection.
+var threading struct {
+	lock		sync.Mutex;
+	configured	bool;
+	mode		int;	// once configured
+}
+
+// Choose the threading mode for SQLite, one of ThreadSingle,
+// ThreadMulti, or ThreadSerialized. This has to happen before
+// the first connection is opened and can happen only once.
+// Without a call to Configure(), we use ThreadSerialized.
+// Whatever the mode, each connection should only be used by
+// one goroutine at a time, see the package documentation.
+func Configure(mode int) (error os.Error) {
+	if mode != ThreadSingle && mode != ThreadMulti && mode != ThreadSerialized {
+		return &DriverError{"Configure: unknown threading mode!"}
+	}
+
+	threading.lock.Lock();
+	defer threading.lock.Unlock();
+
+	if threading.configured {
+		return &DriverError{"Configure: too late, already configured or opened a connection!"}
+	}
+
+	rc := sqlConfig(mode);
+	if rc != StatusOk {
+		// not compiled in, for example
+		return &DriverError{fmt.Sprintf("Configure: SQLite refused threading mode %d (%d)", mode, rc)}
+	}
+	threading.configured = true;
+	threading.mode = mode;
+	return;
+}
 
-	// Supposedly serialized mode is the default,
-	// but let's make sure...
+// Called before opening connections. Supposedly serialized
+// mode is the default, but let's make sure... Returns the
+// threading mode in effect. If SQLite refuses, we stay
+// unconfigured so the next call can try again.
+func configureDefault() (mode int, error os.Error) {
+	threading.lock.Lock();
+	defer threading.lock.Unlock();
+
+	if threading.configured {
+		return threading.mode, nil
+	}
 	rc := sqlConfig(configSerialized);
 	if rc != StatusOk {
-		panic("sqlite3 fatal error: can't switch to serialized mode")
+		error = &DriverError{fmt.Sprintf("Open: SQLite refused serialized threading mode (%d)", rc)};
+		return;
+	}
+	threading.configured = true;
+	threading.mode = ThreadSerialized;
+	return threading.mode, nil;
+}
+
+// Mutex flags for opening a connection. OpenFullMutex would
+// override the threading mode for the connection, so we only
+// add it in serialized mode, and only if the caller didn't
+// ask for OpenNoMutex.
+func mutexFlags(flags int, mode int) int {
+	if mode == ThreadSerialized && flags&(OpenNoMutex|OpenFullMutex) == 0 {
+		flags |= OpenFullMutex
 	}
+	return flags;
 }
 
 // The SQLite database interface returns keys "version",
@@ -94,7 +168,9 @@ func version() (data map[string]string, error os.Error) {
 	return;
 }
 
-func parseConnInfo(str string) (name string, flags int, vfs string, error os.Error) {
+// Turn the URL passed to Open() into an OpenConfig. Any
+// option we don't know about is an error.
+func parseConnInfo(str string) (config *OpenConfig, error os.Error) {
 	var url *http.URL;
 
 	url, error = http.ParseURL(str);
@@ -112,47 +188,95 @@ func parseConnInfo(str string) (name string, flags int, vfs string, error os.Err
 	if len(url.Path) == 0 {
 		error = &DriverError{"Open: no path or database name"};
 		return;
-	} else {
-		name = url.Path
 	}
 
+	c := new(OpenConfig);
+	c.Path = url.Path;
+
 	if len(url.RawQuery) > 0 {
 		options, e := db.ParseQueryURL(url.RawQuery);
 		if e != nil {
 			error = e;
 			return	// XXX really return error from ParseQueryURL?
 		}
-		rflags, ok := options["flags"];
-		if ok {
-			flags, error = strconv.Atoi(rflags);
-			if error != nil {
-				return	// XXX really return error from Atoi?
+		pragmas := make(map[string]string);
+		for key, value := range options {
+			switch {
+			case key == "flags":
+				c.Flags, error = strconv.Atoi(value);
+				if error != nil {
+					return	// XXX really return error from Atoi?
+				}
+			case key == "vfs":
+				c.Vfs = value
+			case key == "cache":
+				c.CacheMode = value
+			case key == "busy_timeout":
+				c.BusyTimeout, error = strconv.Atoi(value);
+				if error != nil || c.BusyTimeout < 0 {
+					error = &DriverError{fmt.Sprintf("Open: bad value %q for option %s", value, key)};
+					return;
+				}
+				// in the URL 0 means what it says
+				c.NoBusyTimeout = c.BusyTimeout == 0;
+			case isURLPragma(key):
+				pragmas[key] = value
+			default:
+				error = &DriverError{fmt.Sprintf("Open: unknown option %s", key)};
+				return;
 			}
 		}
-		vfs, ok = options["vfs"];
+		c.Pragmas, error = urlPragmaList(pragmas);
+		if error != nil {
+			return
+		}
 	}
 
+	config = c;
 	return;
 }
 
 func open(url string) (connection db.Connection, error os.Error) {
-	var name string;
-	var flags int;
-	var vfs string;
+	config, error := parseConnInfo(url);
+	if error != nil {
+		return
+	}
 
-	name, flags, vfs, error = parseConnInfo(url);
+	conn, error := OpenWithConfig(config);
 	if error != nil {
 		return
 	}
 
-	// We want all connections to be in serialized threading
-	// mode, so we fiddle with the flags to make sure.
-	flags &^= OpenNoMutex;
-	flags |= OpenFullMutex;
+	connection = conn;
+	return;
+}
+
+// Open a connection as described by config. This is what
+// Open() does after parsing its URL, but it provides a few
+// more options.
+func OpenWithConfig(config *OpenConfig) (connection *Connection, error os.Error) {
+	error = config.check();
+	if error != nil {
+		return
+	}
+
+	flags := config.Flags;
+	switch config.CacheMode {
+	case "shared":
+		flags |= OpenSharedCache
+	case "private":
+		flags |= OpenPrivateCache
+	}
+
+	mode, error := configureDefault();
+	if error != nil {
+		return
+	}
+	flags = mutexFlags(flags, mode);
 
 	conn := new(Connection);
 	var rc int;
-	conn.handle, rc = sqlOpen(name, flags, vfs);
+	conn.handle, rc = sqlOpen(config.Path, flags, config.Vfs);
 
 	if rc != StatusOk {
 		error = conn.error();
@@ -165,7 +289,15 @@ func open(url string) (connection db.Connection, error os.Error) {
 		return;
 	}
 
-	rc = conn.handle.sqlBusyTimeout(defaultTimeoutMilliseconds);
+	timeout := config.BusyTimeout;
+	switch {
+	case config.NoBusyTimeout:
+		// SQLite turns the busy handler off for 0
+		timeout = 0
+	case timeout == 0:
+		timeout = defaultTimeoutMilliseconds
+	}
+	rc = conn.handle.sqlBusyTimeout(timeout);
 	if rc != StatusOk {
 		error = conn.error();
 		// ignore potential secondary error
@@ -173,7 +305,7 @@ func open(url string) (connection db.Connection, error os.Error) {
 		return;
 	}
 
-	rc = conn.handle.sqlExtendedResultCodes(true);
+	rc = conn.handle.sqlExtendedResultCodes(!config.NoExtendedCodes);
 	if rc != StatusOk {
 		error = conn.error();
 		// ignore potential secondary error
@@ -181,10 +313,52 @@ func open(url string) (connection db.Connection, error os.Error) {
 		return;
 	}
 
+	for _, p := range config.Pragmas {
+		error = conn.pragma(p);
+		if error != nil {
+			// ignore potential secondary error
+			_ = conn.Close();
+			return;
+		}
+	}
+
+	if config.OnUpdate != nil {
+		conn.OnUpdate(config.OnUpdate)
+	}
+	if config.OnCommit != nil {
+		conn.OnCommit(config.OnCommit)
+	}
+	if config.OnRollback != nil {
+		conn.OnRollback(config.OnRollback)
+	}
+
 	connection = conn;
 	return;
 }
 
+// Run a pragma while opening. SQLite quietly keeps the old
+// journal or locking mode if it can't switch (say to WAL for
+// an in-memory database), so we check what it reports back.
+func (self *Connection) pragma(p Pragma) (error os.Error) {
+	result, error := self.execText("PRAGMA " + p.Name + " = " + p.Value);
+	if error != nil {
+		return
+	}
+
+	name := strings.ToLower(p.Name);
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		// schema.journal_mode and the like
+		name = name[i+1 : len(name)]
+	}
+	if name != "journal_mode" && name != "locking_mode" {
+		return
+	}
+	if strings.ToLower(result) != strings.ToLower(p.Value) {
+		error = &DriverError{fmt.Sprintf("Open: can't set %s to %s, still %s", p.Name, p.Value, result)}
+	}
+	return;
+}
+
 /*
 func (self *Cursor) FetchRow() (data map[string]interface{}, error os.Error) {
 	if !self.result {
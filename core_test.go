@@ -8,10 +8,12 @@ import "testing"
 import "os"
 import "db"
 import "fmt"
+import "time"
 
 const (
 	impossibleName	= "randomassdatabase.db";
 	testName	= "testing.db";
+	backupName	= "backup.db";
 )
 
 // Version()
@@ -126,6 +128,1215 @@ func TestCreate(t *testing.T) {
 	c.Close();
 }
 
+// Fetch(): values come back with Go types matching their
+// SQLite storage class
+
+func TestTypedFetch(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	_, e = db.ExecuteDirectly(c,
+		"CREATE TABLE Types(i INTEGER, f REAL, s TEXT, b BLOB, n)");
+	if e != nil {
+		t.Fatal("Failed to create table")
+	}
+	_, e = db.ExecuteDirectly(c,
+		"INSERT INTO Types VALUES (42, 3.5, 'text', x'00ff00', NULL)");
+	if e != nil {
+		t.Fatal("Failed to insert")
+	}
+
+	cc := c.(db.ClassicConnection);
+	s, e := cc.Prepare("SELECT i, f, s, b, n FROM Types");
+	if e != nil {
+		t.Fatal("Failed to prepare")
+	}
+	defer s.Close();
+	rs, e := cc.ExecuteClassic(s);
+	if e != nil {
+		t.Fatal("Failed to execute")
+	}
+	r := rs.Fetch();
+	if r.Error() != nil {
+		t.Fatalf("Failed to fetch: %s", r.Error())
+	}
+	d := r.Data();
+
+	if v, ok := d[0].(int64); !ok || v != 42 {
+		t.Errorf("expected int64 42, got %v", d[0])
+	}
+	if v, ok := d[1].(float64); !ok || v != 3.5 {
+		t.Errorf("expected float64 3.5, got %v", d[1])
+	}
+	if v, ok := d[2].(string); !ok || v != "text" {
+		t.Errorf("expected string \"text\", got %v", d[2])
+	}
+	if v, ok := d[3].([]byte); !ok || len(v) != 3 || v[0] != 0 || v[1] != 0xff || v[2] != 0 {
+		t.Errorf("expected []byte 00ff00, got %v", d[3])
+	}
+	if d[4] != nil {
+		t.Errorf("expected nil, got %v", d[4])
+	}
+}
+
+// Execute(): parameters are bound according to their Go type
+
+func TestTypedBind(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	_, e = db.ExecuteDirectly(c, "DELETE FROM Types");
+	if e != nil {
+		t.Fatal("Failed to delete")
+	}
+	_, e = db.ExecuteDirectly(c,
+		"INSERT INTO Types VALUES (?, ?, ?, ?, ?)",
+		7, 0.25, "text", []byte{1, 0, 2}, nil);
+	if e != nil {
+		t.Fatalf("Failed to insert: %s", e)
+	}
+
+	d, e := db.ExecuteDirectly(c,
+		"SELECT typeof(i), typeof(f), typeof(s), typeof(b), typeof(n) FROM Types");
+	if e != nil || len(d) != 1 {
+		t.Fatal("Failed to select")
+	}
+	types := []string{"integer", "real", "text", "blob", "null"};
+	for i, k := range types {
+		if d[0][i] != k {
+			t.Errorf("column %d: expected %s, got %v", i, k, d[0][i])
+		}
+	}
+
+	_, e = db.ExecuteDirectly(c, "INSERT INTO Types (i) VALUES (?)", t);
+	if e == nil {
+		t.Error("Bound a parameter of unsupported type")
+	}
+	_, e = db.ExecuteDirectly(c, "INSERT INTO Types (i) VALUES (?)", uint64(maxInt64)+1);
+	if e == nil {
+		t.Error("Bound a uint64 that overflows int64")
+	}
+	if big := ^uint(0); uint64(big) > maxInt64 {
+		_, e = db.ExecuteDirectly(c, "INSERT INTO Types (i) VALUES (?)", big);
+		if e == nil {
+			t.Error("Bound a uint that overflows int64")
+		}
+	}
+}
+
+// Execute(): named parameters from maps and structs
+
+type namedTest struct {
+	Login		string	"login";
+	Password	string;
+}
+
+func TestNamedBind(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+
+	_, e = db.ExecuteDirectly(c,
+		"INSERT INTO Users (login, password) VALUES (:login, @Password)",
+		namedTest{"named", "secret"});
+	if e != nil {
+		t.Fatalf("Failed to insert from struct: %s", e)
+	}
+
+	d, e := db.ExecuteDirectly(c,
+		"SELECT password FROM Users WHERE login = $login",
+		map[string]interface{}{"login": "named"});
+	if e != nil || len(d) != 1 || d[0][0] != "secret" {
+		t.Fatalf("Failed to select from map: %s", e)
+	}
+
+	_, e = db.ExecuteDirectly(c,
+		"SELECT * FROM Users WHERE login = :login",
+		map[string]interface{}{"login": "named", "extra": 1});
+	if e == nil {
+		t.Error("Bound an unknown parameter name")
+	}
+
+	_, e = db.ExecuteDirectly(c,
+		"SELECT * FROM Users WHERE login = :login AND password = :password",
+		map[string]interface{}{"login": "named"});
+	if e == nil {
+		t.Error("Executed with a missing parameter name")
+	}
+}
+
+// Begin(), Commit(), Rollback()
+
+func countUsers(t *testing.T, c db.Connection, login string) int {
+	d, e := db.ExecuteDirectly(c, "SELECT * FROM Users WHERE login = ?", login);
+	if e != nil {
+		t.Fatalf("Failed to select: %s", e)
+	}
+	return len(d);
+}
+
+func TestTransaction(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	tx, e := conn.Begin(TransactionImmediate);
+	if e != nil {
+		t.Fatalf("Failed to begin: %s", e)
+	}
+	if _, e = conn.Begin(TransactionDeferred); e == nil {
+		t.Error("Began a nested transaction")
+	}
+	_, e = db.ExecuteDirectly(c, "INSERT INTO Users (login, password) VALUES ('tx', 'tx')");
+	if e != nil {
+		t.Fatalf("Failed to insert: %s", e)
+	}
+	if e = tx.Rollback(); e != nil {
+		t.Fatalf("Failed to roll back: %s", e)
+	}
+	if countUsers(t, c, "tx") != 0 {
+		t.Error("Rolled back insert is still there")
+	}
+	if e = tx.Commit(); e == nil {
+		t.Error("Committed a finished transaction")
+	}
+
+	e = conn.Transact(TransactionDeferred, func(*Transaction) os.Error {
+		_, e := db.ExecuteDirectly(c, "INSERT INTO Users (login, password) VALUES ('tx', 'tx')");
+		return e;
+	});
+	if e != nil {
+		t.Fatalf("Failed to run transaction: %s", e)
+	}
+	if countUsers(t, c, "tx") != 1 {
+		t.Error("Committed insert is missing")
+	}
+	if conn.InTransaction() {
+		t.Error("Transaction still active after commit")
+	}
+}
+
+// Savepoint(), Release(), Rollback()
+
+func TestSavepoint(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	outer, e := conn.Savepoint();
+	if e != nil {
+		t.Fatalf("Failed to start savepoint: %s", e)
+	}
+	inner, e := conn.Savepoint();
+	if e != nil {
+		t.Fatalf("Failed to start nested savepoint: %s", e)
+	}
+	if outer.String() == inner.String() {
+		t.Error("Savepoint names are not unique")
+	}
+	if e = outer.Release(); e == nil {
+		t.Error("Released savepoints out of order")
+	}
+
+	_, e = db.ExecuteDirectly(c, "INSERT INTO Users (login, password) VALUES ('sp', 'sp')");
+	if e != nil {
+		t.Fatalf("Failed to insert: %s", e)
+	}
+	if e = inner.Rollback(); e != nil {
+		t.Fatalf("Failed to roll back savepoint: %s", e)
+	}
+	if countUsers(t, c, "sp") != 0 {
+		t.Error("Rolled back insert is still there")
+	}
+	if e = outer.Release(); e != nil {
+		t.Fatalf("Failed to release savepoint: %s", e)
+	}
+	if conn.InTransaction() {
+		t.Error("Transaction still active after releasing outermost savepoint")
+	}
+}
+
+// ExecuteClassicCancel(): a fired cancel channel stops execution
+
+func TestCancel(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadOnly));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	s, e := conn.Prepare("SELECT * FROM Users");
+	if e != nil {
+		t.Fatal("Failed to prepare")
+	}
+	defer s.Close();
+
+	cancel := make(chan bool);
+	close(cancel);
+	_, e = conn.ExecuteClassicCancel(cancel, s);
+	if e != ErrCancelled {
+		t.Errorf("expected ErrCancelled, got %v", e)
+	}
+
+	// the statement is still good afterwards
+	rs, e := conn.ExecuteClassic(s);
+	if e != nil || !rs.More() {
+		t.Errorf("Failed to execute after cancel: %v", e)
+	}
+
+	// cancel a query while SQLite is busy with it
+	long, e := conn.Prepare(
+		"WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c) " +
+			"SELECT count(*) FROM c");
+	if e != nil {
+		t.Fatal("Failed to prepare")
+	}
+	defer long.Close();
+
+	cancel = make(chan bool);
+	go func() {
+		time.Sleep(50e6);
+		cancel <- true;
+	}();
+	_, e = conn.ExecuteClassicCancel(cancel, long);
+	if e != ErrCancelled {
+		t.Errorf("expected ErrCancelled, got %v", e)
+	}
+
+	// and nothing is left pending for the next query
+	if _, e = db.ExecuteDirectly(c, "SELECT count(*) FROM Users"); e != nil {
+		t.Errorf("Failed to execute after cancel: %s", e)
+	}
+}
+
+// RegisterFunc(): Go functions callable from SQL
+
+func twice(args []interface{}) (interface{}, os.Error) {
+	if len(args) != 1 {
+		return nil, &DriverError{"twice: need one argument"}
+	}
+	switch v := args[0].(type) {
+	case int64:
+		return 2 * v, nil
+	case string:
+		return v + v, nil
+	}
+	return nil, &DriverError{"twice: unsupported argument"};
+}
+
+func TestFunction(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadOnly));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	if e = conn.RegisterFunc("twice", twice, true); e != nil {
+		t.Fatalf("Failed to register function: %s", e)
+	}
+
+	d, e := db.ExecuteDirectly(c, "SELECT twice(21), twice('ab')");
+	if e != nil || len(d) != 1 {
+		t.Fatalf("Failed to call function: %s", e)
+	}
+	if v, ok := d[0][0].(int64); !ok || v != 42 {
+		t.Errorf("expected int64 42, got %v", d[0][0])
+	}
+	if d[0][1] != "abab" {
+		t.Errorf("expected \"abab\", got %v", d[0][1])
+	}
+
+	if _, e = db.ExecuteDirectly(c, "SELECT twice(1.5)"); e == nil {
+		t.Error("Function error didn't fail the query")
+	}
+}
+
+// RegisterAggregate(): Go aggregates with per-group state
+
+type longest struct {
+	best string;
+}
+
+func (self *longest) Step(args []interface{}) os.Error {
+	if s, ok := args[0].(string); ok && len(s) > len(self.best) {
+		self.best = s
+	}
+	return nil;
+}
+
+func (self *longest) Final() (interface{}, os.Error)	{ return self.best, nil }
+
+func TestAggregate(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadOnly));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	e = conn.RegisterAggregate("longest",
+		func() Aggregate { return new(longest) }, true);
+	if e != nil {
+		t.Fatalf("Failed to register aggregate: %s", e)
+	}
+
+	d, e := db.ExecuteDirectly(c,
+		"SELECT password = 'somepassword', longest(login) FROM Users " +
+			"WHERE login IN ('phf', 'adt', 'abc') GROUP BY 1 ORDER BY 1");
+	if e != nil || len(d) != 2 {
+		t.Fatalf("Failed to call aggregate: %s", e)
+	}
+	if d[0][1] != "abc" || d[1][1] != "phf" && d[1][1] != "adt" {
+		t.Errorf("unexpected groups %v", d)
+	}
+}
+
+// RegisterWindow(): Inverse() as rows leave the frame
+
+type movingSum struct {
+	sum		int64;
+	inverses	*int;
+}
+
+func (self *movingSum) Step(args []interface{}) os.Error {
+	self.sum += args[0].(int64);
+	return nil;
+}
+
+func (self *movingSum) Inverse(args []interface{}) os.Error {
+	self.sum -= args[0].(int64);
+	*self.inverses++;
+	return nil;
+}
+
+func (self *movingSum) Value() (interface{}, os.Error)	{ return self.sum, nil }
+
+func (self *movingSum) Final() (interface{}, os.Error)	{ return self.sum, nil }
+
+func TestWindow(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadOnly));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	inverses := 0;
+	e = conn.RegisterWindow("movingsum",
+		func() WindowAggregate { return &movingSum{0, &inverses} }, true);
+	if e != nil {
+		t.Fatalf("Failed to register window function: %s", e)
+	}
+
+	d, e := db.ExecuteDirectly(c,
+		"SELECT movingsum(x) OVER (ORDER BY x ROWS BETWEEN 1 PRECEDING AND CURRENT ROW) " +
+			"FROM (SELECT 1 AS x UNION SELECT 2 UNION SELECT 3 UNION SELECT 4)");
+	if e != nil || len(d) != 4 {
+		t.Fatalf("Failed to call window function: %s", e)
+	}
+	for i, k := range []int64{1, 3, 5, 7} {
+		if d[i][0] != k {
+			t.Errorf("row %d: expected %d, got %v", i, k, d[i][0])
+		}
+	}
+	if inverses == 0 {
+		t.Error("Inverse was never called")
+	}
+}
+
+// RegisterCollation(), OnCollationNeeded()
+
+type compareTest struct {
+	a, b	string;
+	natural	int;
+	fold	int;
+}
+
+var compareTests = []compareTest{
+	compareTest{"file2", "file10", -1, 1},
+	compareTest{"file10", "file10", 0, 0},
+	compareTest{"file02", "file2", 1, -1},
+	compareTest{"Äpfel", "äpfel", -1, 0},
+	compareTest{"a", "ab", -1, -1},
+}
+
+func TestCompare(t *testing.T) {
+	for _, k := range compareTests {
+		if c := NaturalCompare(k.a, k.b); c != k.natural {
+			t.Errorf("NaturalCompare(%q, %q) = %d, expected %d", k.a, k.b, c, k.natural)
+		}
+		if c := FoldCompare(k.a, k.b); c != k.fold {
+			t.Errorf("FoldCompare(%q, %q) = %d, expected %d", k.a, k.b, c, k.fold)
+		}
+	}
+}
+
+func TestCollation(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadOnly));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	e = conn.OnCollationNeeded(func(conn *Connection, name string) {
+		if name == "natural" {
+			conn.RegisterCollation(name, NaturalCompare)
+		}
+	});
+	if e != nil {
+		t.Fatalf("Failed to set callback: %s", e)
+	}
+
+	d, e := db.ExecuteDirectly(c,
+		"SELECT x FROM (SELECT 'file10' AS x UNION SELECT 'file2') " +
+			"ORDER BY x COLLATE natural");
+	if e != nil || len(d) != 2 {
+		t.Fatalf("Failed to use collation: %s", e)
+	}
+	if d[0][0] != "file2" || d[1][0] != "file10" {
+		t.Errorf("unexpected order %v", d)
+	}
+}
+
+// OpenBlob(): incremental BLOB I/O
+
+func TestBlob(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	_, e = db.ExecuteDirectly(c, "INSERT INTO Types (b) VALUES (?)", ZeroBlob(8));
+	if e != nil {
+		t.Fatalf("Failed to insert: %s", e)
+	}
+	rowid, _ := conn.LastId();
+
+	b, e := conn.OpenBlob("main", "Types", "b", rowid, true);
+	if e != nil {
+		t.Fatalf("Failed to open blob: %s", e)
+	}
+	defer b.Close();
+
+	if b.Size() != 8 {
+		t.Errorf("expected size 8, got %d", b.Size())
+	}
+	if n, e := b.Write([]byte("hello")); n != 5 || e != nil {
+		t.Errorf("Failed to write: %d %s", n, e)
+	}
+	if n, e := b.Write([]byte("world")); n != 3 || e == nil {
+		t.Errorf("Wrote past the end: %d %s", n, e)
+	}
+	if _, e := b.Seek(1, 0); e != nil {
+		t.Errorf("Failed to seek: %s", e)
+	}
+	p := make([]byte, 4);
+	if n, e := b.Read(p); n != 4 || e != nil || string(p) != "ello" {
+		t.Errorf("Failed to read: %d %s %q", n, e, p)
+	}
+	if n, e := b.ReadAt(p, 6); n != 2 || e != os.EOF || string(p[0:2]) != "wo" {
+		t.Errorf("Failed to read at: %d %s %q", n, e, p)
+	}
+}
+
+// Backup(): copy a database between connections
+
+func TestBackup(t *testing.T) {
+	src, e := Open(testName + "?" + FlagsURL(OpenReadOnly));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer src.Close();
+	dest, e := Open(backupName + "?" + FlagsURL(OpenReadWrite|OpenCreate));
+	if e != nil {
+		t.Fatal("Failed to create database")
+	}
+	defer os.Remove(backupName);
+	defer dest.Close();
+
+	b, e := src.(*Connection).Backup(dest.(*Connection), "main", "main");
+	if e != nil {
+		t.Fatalf("Failed to start backup: %s", e)
+	}
+	calls := 0;
+	e = b.Run(1, 1000000, func(remaining, total int) { calls++ });
+	if e != nil {
+		t.Fatalf("Failed to run backup: %s", e)
+	}
+	if calls == 0 {
+		t.Error("Progress was never reported")
+	}
+
+	if countUsers(t, dest, "phf") != 1 {
+		t.Error("Backup is missing data")
+	}
+
+	b, e = src.(*Connection).Backup(dest.(*Connection), "main", "main");
+	if e != nil {
+		t.Fatalf("Failed to start backup: %s", e)
+	}
+	cancel := make(chan bool);
+	close(cancel);
+	if e = b.RunCancel(cancel, 1, 1000000, nil); e != ErrCancelled {
+		t.Errorf("expected ErrCancelled, got %v", e)
+	}
+}
+
+// Serialize(), Deserialize()
+
+func TestSerialize(t *testing.T) {
+	src, e := Open(testName + "?" + FlagsURL(OpenReadOnly));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer src.Close();
+	dest, e := Open(backupName + "?" + FlagsURL(OpenReadWrite|OpenCreate));
+	if e != nil {
+		t.Fatal("Failed to create database")
+	}
+	defer os.Remove(backupName);
+	defer dest.Close();
+
+	data, e := src.(*Connection).Serialize("main");
+	if e != nil {
+		t.Fatalf("Failed to serialize: %s", e)
+	}
+	e = dest.(*Connection).Deserialize("main", data, true);
+	if e != nil {
+		t.Fatalf("Failed to deserialize: %s", e)
+	}
+
+	if countUsers(t, dest, "phf") != 1 {
+		t.Error("Deserialized database is missing data")
+	}
+	_, e = db.ExecuteDirectly(dest, "DELETE FROM Users");
+	if e == nil {
+		t.Error("Changed a read-only database")
+	}
+}
+
+// OnUpdate(), OnCommit(), OnRollback()
+
+func TestHooks(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	updates, commits, rollbacks := 0, 0, 0;
+	conn.OnUpdate(func(op, db, table string, rowid int64) {
+		if op != "INSERT" || db != "main" || table != "Users" {
+			t.Errorf("unexpected update %s %s %s", op, db, table)
+		}
+		updates++;
+	});
+	conn.OnCommit(func() bool { commits++; return commits > 1 });
+	conn.OnRollback(func() { rollbacks++ });
+
+	insert := "INSERT INTO Users (login, password) VALUES ('hook', 'hook')";
+	if _, e = db.ExecuteDirectly(c, insert); e == nil {
+		t.Error("Commit wasn't vetoed")
+	}
+	if _, e = db.ExecuteDirectly(c, insert); e != nil {
+		t.Errorf("Failed to insert: %s", e)
+	}
+	if updates != 2 || commits != 2 || rollbacks != 1 {
+		t.Errorf("unexpected counts %d %d %d", updates, commits, rollbacks)
+	}
+
+	// a panic vetoes instead of unwinding through SQLite
+	conn.OnCommit(func() bool { panic("commit hook") });
+	if _, e = db.ExecuteDirectly(c, insert); e == nil {
+		t.Error("Commit wasn't vetoed by panic")
+	}
+
+	conn.OnUpdate(nil);
+	conn.OnCommit(nil);
+	conn.OnRollback(nil);
+}
+
+// ChangeFeed(): changes show up only after commit
+
+func TestChangeFeed(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	feed, e := conn.ChangeFeed(10);
+	if e != nil {
+		t.Fatalf("Failed to start feed: %s", e)
+	}
+
+	tx, _ := conn.Begin(TransactionDeferred);
+	db.ExecuteDirectly(c, "INSERT INTO Users (login, password) VALUES ('feed1', 'x')");
+	tx.Rollback();
+
+	tx, _ = conn.Begin(TransactionDeferred);
+	db.ExecuteDirectly(c, "INSERT INTO Users (login, password) VALUES ('feed2', 'x')");
+	if len(feed.Changes()) != 0 {
+		t.Error("Change delivered before commit")
+	}
+	if e = tx.Commit(); e != nil {
+		t.Fatalf("Failed to commit: %s", e)
+	}
+
+	if len(feed.Changes()) != 1 {
+		t.Fatalf("expected 1 change, got %d", len(feed.Changes()))
+	}
+	change := <-feed.Changes();
+	if change.Op != ActionInsert || change.Table != "Users" {
+		t.Errorf("unexpected change %v", change)
+	}
+
+	// releasing the outermost savepoint commits, but not
+	// what was rolled back
+	sp, _ := conn.Savepoint();
+	db.ExecuteDirectly(c, "INSERT INTO Users (login, password) VALUES ('feed3', 'x')");
+	if e = sp.Rollback(); e != nil {
+		t.Fatalf("Failed to roll back savepoint: %s", e)
+	}
+	if len(feed.Changes()) != 0 {
+		t.Error("Rolled back savepoint delivered changes")
+	}
+
+	tx, _ = conn.Begin(TransactionDeferred);
+	db.ExecuteDirectly(c, "INSERT INTO Users (login, password) VALUES ('feed4', 'x')");
+	sp, _ = conn.Savepoint();
+	db.ExecuteDirectly(c, "INSERT INTO Users (login, password) VALUES ('feed5', 'x')");
+	sp.Rollback();
+	// the second row fails, undoing the first
+	_, e = db.ExecuteDirectly(c,
+		"INSERT INTO Users (login, password) SELECT 'feed6', 'x' UNION ALL SELECT 'phf', 'x'");
+	if e == nil {
+		t.Error("Inserted duplicate login")
+	}
+	if e = tx.Commit(); e != nil {
+		t.Fatalf("Failed to commit: %s", e)
+	}
+	if len(feed.Changes()) != 1 {
+		t.Fatalf("expected 1 change, got %d", len(feed.Changes()))
+	}
+	if change = <-feed.Changes(); change.RowId == 0 {
+		t.Errorf("unexpected change %v", change)
+	}
+	if countUsers(t, c, "feed4") != 1 {
+		t.Error("Committed insert is missing")
+	}
+	feed.Close();
+}
+
+// SetAuthorizer(): deny actions while preparing
+
+func TestAuthorizer(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	e = conn.SetAuthorizer(func(action int, arg1, arg2, db, trigger string) int {
+		switch action {
+		case ActionDelete:
+			return AuthDeny
+		case ActionRead:
+			if arg2 == "password" {
+				return AuthIgnore
+			}
+		}
+		return AuthOk;
+	});
+	if e != nil {
+		t.Fatalf("Failed to set authorizer: %s", e)
+	}
+
+	if _, e = conn.Prepare("DELETE FROM Users"); e == nil {
+		t.Error("Prepared a denied statement")
+	} else if e.(*SystemError).Basic() != StatusAuth {
+		t.Errorf("expected StatusAuth, got %s", e)
+	}
+
+	d, e := db.ExecuteDirectly(c, "SELECT login, password FROM Users WHERE login = 'phf'");
+	if e != nil || len(d) != 1 {
+		t.Fatalf("Failed to select: %s", e)
+	}
+	if d[0][1] != nil {
+		t.Errorf("ignored column not NULL: %v", d[0][1])
+	}
+
+	conn.SetAuthorizer(func(action int, arg1, arg2, db, trigger string) int {
+		panic("authorizer")
+	});
+	if _, e = conn.Prepare("SELECT login FROM Users"); e == nil {
+		t.Error("Panicking authorizer didn't deny")
+	}
+
+	conn.SetAuthorizer(nil);
+}
+
+// SetPolicy(): read-only sandbox
+
+func TestPolicy(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	e = conn.SetPolicy(&ReadOnlyPolicy{
+		Tables: []string{"users"},
+		Columns: map[string][]string{"Users": []string{"login"}},
+		DeniedFunctions: []string{"randomblob"},
+	});
+	if e != nil {
+		t.Fatalf("Failed to set policy: %s", e)
+	}
+
+	denied := []string{
+		"SELECT password FROM Users",
+		"SELECT * FROM Types",
+		"SELECT randomblob(4)",
+		"DELETE FROM Users",
+		"PRAGMA user_version = 1",
+		"ATTACH 'other.db' AS other",
+	};
+	for _, q := range denied {
+		if _, e = conn.Prepare(q); e == nil {
+			t.Errorf("Prepared %q", q)
+		} else if _, ok := e.(*DriverError); !ok {
+			t.Errorf("expected DriverError for %q, got %s", q, e)
+		}
+	}
+
+	s, e := conn.Prepare("SELECT login FROM Users");
+	if e != nil {
+		t.Fatalf("Failed to prepare allowed query: %s", e)
+	}
+	s.Close();
+	conn.SetPolicy(nil);
+
+	// views don't get around column restrictions
+	_, e = db.ExecuteDirectly(c,
+		"CREATE VIEW IF NOT EXISTS Accounts AS SELECT login, password FROM Users");
+	if e != nil {
+		t.Fatalf("Failed to create view: %s", e)
+	}
+	conn.SetPolicy(&ReadOnlyPolicy{
+		Columns: map[string][]string{"Users": []string{"login"}},
+	});
+	if _, e = conn.Prepare("SELECT password FROM Accounts"); e == nil {
+		t.Error("Read denied column through view")
+	}
+
+	// but listed views open up their tables
+	conn.SetPolicy(&ReadOnlyPolicy{Tables: []string{"Accounts"}});
+	if s, e = conn.Prepare("SELECT login FROM Accounts"); e != nil {
+		t.Errorf("Failed to read through listed view: %s", e)
+	} else {
+		s.Close()
+	}
+	if _, e = conn.Prepare("SELECT login FROM Users"); e == nil {
+		t.Error("Read unlisted table")
+	}
+	conn.SetPolicy(nil);
+}
+
+// SetTrace(): see statements as they run
+
+func TestTrace(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadOnly));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	var started, profiled int;
+	e = conn.SetTrace(TraceStatement|TraceProfile, func(event TraceEvent) {
+		switch event.Type {
+		case TraceStatement:
+			if event.ExpandedSQL != "SELECT * FROM Users WHERE login = 'phf'" {
+				t.Errorf("unexpected SQL %q", event.ExpandedSQL)
+			}
+			started++;
+		case TraceProfile:
+			if event.Duration < 0 {
+				t.Errorf("negative duration %d", event.Duration)
+			}
+			profiled++;
+		}
+	});
+	if e != nil {
+		t.Fatalf("Failed to set trace: %s", e)
+	}
+
+	countUsers(t, c, "phf");
+	if started != 1 || profiled != 1 {
+		t.Errorf("unexpected counts %d %d", started, profiled)
+	}
+	conn.SetTrace(0, nil);
+
+	// triggers report in by name
+	w, e := Open(testName + "?" + FlagsURL(OpenReadWrite));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer w.Close();
+	_, e = db.ExecuteDirectly(w, "CREATE TEMP TABLE Log(login)");
+	if e != nil {
+		t.Fatalf("Failed to create table: %s", e)
+	}
+	_, e = db.ExecuteDirectly(w,
+		"CREATE TEMP TRIGGER LogInsert AFTER INSERT ON Users " +
+			"BEGIN INSERT INTO Log VALUES (new.login); END");
+	if e != nil {
+		t.Fatalf("Failed to create trigger: %s", e)
+	}
+
+	trigger, fired := "", 0;
+	w.(*Connection).SetTrace(TraceStatement, func(event TraceEvent) {
+		if len(event.Trigger) > 0 {
+			trigger = event.Trigger;
+			fired++;
+		}
+	});
+	db.ExecuteDirectly(w, "INSERT INTO Users (login, password) VALUES ('trace', 'x')");
+	db.ExecuteDirectly(w, "-- not a trigger\nSELECT 1");
+	w.(*Connection).SetTrace(0, nil);
+	db.ExecuteDirectly(w, "DELETE FROM Users WHERE login = 'trace'");
+
+	if fired != 1 || trigger != "LogInsert" {
+		t.Errorf("trigger not traced: %d %q", fired, trigger)
+	}
+}
+
+// SetSlowQueryLog(): report statements over a threshold
+
+type normalizeTest struct {
+	sql, normalized string;
+}
+
+var normalizeTests = []normalizeTest{
+	normalizeTest{"SELECT  *\n\tFROM t1", "SELECT * FROM t1"},
+	normalizeTest{"SELECT 'it''s' LIMIT 10", "SELECT ? LIMIT ?"},
+	normalizeTest{"WHERE x=1.5 AND y = ?", "WHERE x=? AND y = ?"},
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	for _, k := range normalizeTests {
+		if n := normalizeSQL(k.sql); n != k.normalized {
+			t.Errorf("normalizeSQL(%q) = %q, expected %q", k.sql, n, k.normalized)
+		}
+	}
+
+	c, e := Open(testName + "?" + FlagsURL(OpenReadOnly));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	var slow []SlowQuery;
+	e = conn.SetSlowQueryLog(0, func(q SlowQuery) {
+		s := make([]SlowQuery, len(slow)+1);
+		copy(s, slow);
+		s[len(slow)] = q;
+		slow = s;
+	});
+	if e != nil {
+		t.Fatalf("Failed to set slow query log: %s", e)
+	}
+
+	d, e := db.ExecuteDirectly(c, "SELECT login FROM Users WHERE password <> 'x'");
+	if e != nil {
+		t.Fatalf("Failed to select: %s", e)
+	}
+	if len(slow) != 1 {
+		t.Fatalf("expected 1 slow query, got %d", len(slow))
+	}
+	if slow[0].SQL != "SELECT login FROM Users WHERE password <> ?" {
+		t.Errorf("unexpected SQL %q", slow[0].SQL)
+	}
+	if slow[0].Rows != len(d) {
+		t.Errorf("expected %d rows, got %d", len(d), slow[0].Rows)
+	}
+	if slow[0].Stats.FullScanSteps == 0 {
+		t.Error("full scan not counted")
+	}
+	conn.SetSlowQueryLog(0, nil);
+}
+
+// Stats(): per-statement counters
+
+func TestStats(t *testing.T) {
+	c, e := Open(testName + "?" + FlagsURL(OpenReadOnly));
+	if e != nil {
+		t.Fatal("Failed to open existing database")
+	}
+	defer c.Close();
+	conn := c.(*Connection);
+
+	scan, e := conn.Prepare("SELECT * FROM Users WHERE password = ?");
+	if e != nil {
+		t.Fatal("Failed to prepare")
+	}
+	defer scan.Close();
+	lookup, e := conn.Prepare("SELECT * FROM Users WHERE login = ?");
+	if e != nil {
+		t.Fatal("Failed to prepare")
+	}
+	defer lookup.Close();
+
+	for _, s := range []db.Statement{scan, lookup} {
+		rs, e := conn.ExecuteClassic(s, "somepassword");
+		if e != nil {
+			t.Fatalf("Failed to execute: %s", e)
+		}
+		for rs != nil && rs.More() {
+			rs.Fetch()
+		}
+	}
+
+	if st := scan.(*Statement).Stats(true); st.FullScanSteps == 0 || st.VMSteps == 0 {
+		t.Errorf("full scan not counted: %v", st)
+	}
+	if st := scan.(*Statement).Stats(false); st.FullScanSteps != 0 {
+		t.Errorf("counters not reset: %v", st)
+	}
+	if st := lookup.(*Statement).Stats(false); st.FullScanSteps != 0 {
+		t.Errorf("indexed lookup did a full scan: %v", st)
+	}
+}
+
+// OpenWithConfig(), parseConnInfo()
+
+func TestConfig(t *testing.T) {
+	config, e := parseConnInfo(testName + "?cache=shared&" + FlagsURL(OpenReadOnly));
+	if e != nil {
+		t.Fatalf("Failed to parse URL: %s", e)
+	}
+	if config.Path != testName || config.Flags != OpenReadOnly || config.CacheMode != "shared" {
+		t.Errorf("unexpected config %v", config)
+	}
+	if _, e = parseConnInfo(testName + "?flagz=1"); e == nil {
+		t.Error("Accepted unknown option")
+	}
+
+	config, e = parseConnInfo(testName + "?foreign_keys=ON&journal_mode=wal&locking_mode=exclusive&busy_timeout=0");
+	if e != nil {
+		t.Fatalf("Failed to parse URL: %s", e)
+	}
+	if !config.NoBusyTimeout {
+		t.Error("busy_timeout=0 still retries")
+	}
+	order := []string{"locking_mode", "journal_mode", "foreign_keys"};
+	if len(config.Pragmas) != len(order) {
+		t.Fatalf("unexpected pragmas %v", config.Pragmas)
+	}
+	for i, name := range order {
+		if config.Pragmas[i].Name != name {
+			t.Errorf("pragma %d: expected %s, got %s", i, name, config.Pragmas[i].Name)
+		}
+	}
+	if config.Pragmas[2].Value != "on" {
+		t.Errorf("unexpected value %s", config.Pragmas[2].Value)
+	}
+	if _, e = parseConnInfo(testName + "?journal_mode=sideways"); e == nil {
+		t.Error("Accepted bad journal_mode")
+	}
+	if _, e = parseConnInfo(testName + "?cache_size=lots"); e == nil {
+		t.Error("Accepted bad cache_size")
+	}
+
+	conn, e := OpenWithConfig(&OpenConfig{
+		Path: testName,
+		Flags: OpenReadWrite,
+		Pragmas: []Pragma{Pragma{"user_version", "7"}},
+	});
+	if e != nil {
+		t.Fatalf("Failed to open with config: %s", e)
+	}
+	defer conn.Close();
+
+	d, e := db.ExecuteDirectly(conn, "PRAGMA user_version");
+	if e != nil || len(d) != 1 || d[0][0] != int64(7) {
+		t.Errorf("pragma not applied: %v %s", d, e)
+	}
+
+	// in-memory databases can't do WAL
+	_, e = OpenWithConfig(&OpenConfig{
+		Path: ":memory:",
+		Flags: OpenReadWrite,
+		Pragmas: []Pragma{Pragma{"journal_mode", "wal"}},
+	});
+	if e == nil {
+		t.Error("Accepted journal_mode that didn't take")
+	}
+
+	for _, value := range []string{"1; ATTACH 'x.db' AS x", "'it's'", ""} {
+		_, e = OpenWithConfig(&OpenConfig{
+			Path: testName,
+			Pragmas: []Pragma{Pragma{"user_version", value}},
+		});
+		if e == nil {
+			t.Errorf("Accepted pragma value %q", value)
+		}
+	}
+}
+
+// Configure(): only before the first connection
+
+func TestConfigure(t *testing.T) {
+	if e := Configure(42); e == nil {
+		t.Error("Accepted unknown threading mode")
+	}
+	// earlier tests opened connections already
+	if e := Configure(ThreadMulti); e == nil {
+		t.Error("Changed threading mode after opening connections")
+	}
+
+	// only serialized mode gets a mutex per connection
+	if mutexFlags(0, ThreadMulti)&OpenFullMutex != 0 {
+		t.Error("Forced a mutex in multi-thread mode")
+	}
+	if mutexFlags(OpenNoMutex, ThreadSerialized)&OpenFullMutex != 0 {
+		t.Error("Forced a mutex despite OpenNoMutex")
+	}
+	for _, flags := range []int{0, OpenNoMutex} {
+		c, e := OpenWithConfig(&OpenConfig{Path: testName, Flags: OpenReadOnly | flags});
+		if e != nil {
+			t.Fatalf("Failed to open: %s", e)
+		}
+		if c.handle.sqlHasMutex() != (flags == 0) {
+			t.Errorf("unexpected mutex for flags %x", flags)
+		}
+		c.Close();
+	}
+}
+
+// Pool: setup, reuse, limits
+
+func TestPool(t *testing.T) {
+	setups := 0;
+	pool, e := NewPool(&PoolConfig{
+		Open: &OpenConfig{Path: testName, Flags: OpenReadWrite},
+		MaxOpen: 1,
+		MaxIdle: 1,
+		Setup: func(c *Connection) os.Error {
+			setups++;
+			return c.exec("PRAGMA foreign_keys = ON");
+		},
+	});
+	if e != nil {
+		t.Fatalf("Failed to make pool: %s", e)
+	}
+	defer pool.Close();
+
+	c, e := pool.Get(nil);
+	if e != nil {
+		t.Fatalf("Failed to get connection: %s", e)
+	}
+	cancel := make(chan bool, 1);
+	cancel <- true;
+	if _, e = pool.Get(cancel); e != ErrCancelled {
+		t.Errorf("Get beyond MaxOpen not cancelled: %s", e)
+	}
+	pool.Put(c);
+
+	d, e := pool.Get(nil);
+	if e != nil {
+		t.Fatalf("Failed to get connection: %s", e)
+	}
+	if d != c || setups != 1 {
+		t.Errorf("idle connection not reused (%d setups)", setups)
+	}
+	if e = pool.Put(d); e != nil {
+		t.Errorf("Failed to put connection back: %s", e)
+	}
+	// would block forever if accepted
+	if e = pool.Put(d); e == nil {
+		t.Error("Put the same connection back twice")
+	}
+}
+
+// RWPool: reads go to readers, writes to the writer
+
+func TestRWPool(t *testing.T) {
+	pool, e := NewRWPool(&RWPoolConfig{
+		Open: &OpenConfig{Path: testName, Flags: OpenReadWrite},
+		Readers: 2,
+	});
+	if e != nil {
+		t.Fatalf("Failed to make pool: %s", e)
+	}
+	defer pool.Close();
+
+	d, e := pool.Execute("PRAGMA journal_mode");
+	if e != nil || len(d) != 1 || d[0][0] != "wal" {
+		t.Errorf("not in WAL mode: %v %s", d, e)
+	}
+	if _, e = pool.Execute("INSERT INTO Users (login, password) VALUES (?, ?)", "rw", "pool"); e != nil {
+		t.Fatalf("Failed to insert: %s", e)
+	}
+	d, e = pool.Execute("SELECT password FROM Users WHERE login = ?", "rw");
+	if e != nil || len(d) != 1 || d[0][0] != "pool" {
+		t.Errorf("unexpected result %v %s", d, e)
+	}
+	e = pool.Read(nil, func(c *Connection) os.Error {
+		return c.exec("DELETE FROM Users WHERE login = 'rw'")
+	});
+	if e == nil {
+		t.Error("Reader accepted a write")
+	}
+	if _, e = pool.Execute("DELETE FROM Users WHERE login = ?", "rw"); e != nil {
+		t.Errorf("Failed to delete: %s", e)
+	}
+
+	// transactions only through Write()
+	if _, e = pool.Execute(" /* tx */ begin"); e == nil {
+		t.Error("Executed BEGIN")
+	}
+	e = pool.Write(func(c *Connection) os.Error {
+		tx, e := c.Begin(TransactionImmediate);
+		if e != nil {
+			return e
+		}
+		c.exec("INSERT INTO Users (login, password) VALUES ('rw', 'tx')");
+		return tx.Rollback();
+	});
+	if e != nil {
+		t.Errorf("Failed to write: %s", e)
+	}
+	if d, e = pool.Execute("SELECT * FROM Users WHERE login = 'rw'"); e != nil || len(d) != 0 {
+		t.Errorf("Rolled back insert is there: %v %s", d, e)
+	}
+}
+
 // clean up: remove the test database
 
 func TestDummy(t *testing.T)	{ os.Remove(testName) }
@@ -10,24 +10,140 @@
 //
 // Restrictions on Types:
 //
-// For now, we treat *all* values as strings. This is less of
-// an issue for SQLite since it's typed dynamically anyway.
-// Accepting/returning appropriate Go types is a high priority
-// goal though.
+// Results are returned according to the storage class of each
+// value: INTEGER as int64, REAL as float64, TEXT as string,
+// BLOB as []byte, and NULL as nil. Note that SQLite is typed
+// dynamically, so the same column can produce different Go
+// types in different rows.
+//
+// Parameters are bound according to their Go type: integers
+// as INTEGER, floats as REAL, strings as TEXT, []byte as BLOB,
+// and nil as NULL. Booleans are bound as 0 and 1, and passing
+// a ZeroBlob reserves a BLOB of the given size. Other types
+// are rejected with a DriverError.
 //
 // Binding Query Parameters:
 //
 // SQL queries can contain "?" parameter slots that are bound
-// to values in Execute(). SQLite has more variations that we
-// don't support for now: they would make the API more complex
-// for very little gain. Parameter slots are matched to values
+// to values in Execute(). Parameter slots are matched to values
 // in order of appearance.
 //
+// Queries can also contain named ":name", "@name", or "$name"
+// parameters. These are bound by passing a single value to
+// Execute(), either a map[string]interface{} or a struct (or
+// a pointer to one). Struct fields are matched by their tag
+// if present, by their field name otherwise. Names can be
+// given with or without prefix. Missing or unknown names are
+// reported as DriverErrors.
+//
+// Opening Connections:
+//
+// Open() takes a URL with the database path and options:
+// "flags" (see FlagsURL()), "vfs", "cache" (shared or private),
+// "busy_timeout" in milliseconds, and the pragmas locking_mode,
+// journal_mode, synchronous, cache_size, mmap_size, temp_store,
+// and foreign_keys. Pragmas are run in that order right after
+// opening. Unknown options and bad values are errors, and so
+// are journal and locking modes SQLite doesn't switch to. A
+// busy_timeout of 0 turns retrying off. For more control use
+// OpenWithConfig().
+//
+// Transactions:
+//
+// Connection.Begin() starts a transaction and returns a
+// Transaction to Commit() or Rollback(). SQLite doesn't nest
+// transactions, so a second Begin() on the same connection is
+// an error until the first transaction is finished. Note that
+// SQLite rolls back on its own after some errors; Rollback()
+// is always safe to call, Commit() then fails.
+//
+// Connection.Savepoint() provides nested transactions that work
+// with or without an enclosing Transaction. Savepoints must be
+// released or rolled back innermost first; releasing the
+// outermost one without an enclosing Transaction commits.
+//
+// Functions:
+//
+// Go functions can be called from SQL after registering them
+// with Connection.RegisterFunc(). Arguments and results use
+// the same Go types as results and parameters of queries.
+// Aggregates and window functions are registered with a
+// factory that makes a fresh Aggregate for each group, see
+// RegisterAggregate() and RegisterWindow(). Collations can
+// be registered in the same way with RegisterCollation();
+// FoldCompare() and NaturalCompare() are ready to use.
+//
+// BLOBs:
+//
+// Connection.OpenBlob() provides incremental I/O on a single
+// BLOB value, useful for values too big to handle in one go.
+//
+// Backups:
+//
+// Connection.Backup() copies a database into another one while
+// the source stays in use, see Backup.Run() for the easy way.
+// Connection.Serialize() and Connection.Deserialize() turn a
+// whole database into a []byte and back without going through
+// the file system.
+//
+// Hooks:
+//
+// Connection.OnUpdate(), OnCommit(), and OnRollback() register
+// Go callbacks for changes to the database. They run in the
+// middle of SQLite operations and must not use the connection
+// they are registered with. Connection.ChangeFeed() delivers
+// changes on a channel instead, but only once they have been
+// committed. Connection.SetTrace() reports statements as
+// they run, including how long they took, and
+// Connection.SetSlowQueryLog() reports those that take too
+// long. Statement.Stats() returns the performance counters of
+// a single statement.
+//
+// Authorization:
+//
+// Connection.SetAuthorizer() registers a Go function that
+// decides which actions statements may perform; it runs
+// while statements are prepared, not while they execute.
+// Connection.SetPolicy() installs a ready-made authorizer that
+// only allows reading from selected tables and columns.
+//
+// Cancellation:
+//
+// Prepare(), Execute(), ExecuteClassic(), Fetch(), and
+// Backup.Run() have XYZCancel() variants that take a cancel
+// channel. Sending a value on the channel (or closing it)
+// interrupts SQLite and makes the operation fail with
+// ErrCancelled. Interrupt() can also be called directly from
+// any goroutine.
+//
 // Concurrency:
 //
-// We still need to address concurrency issues in detail, for
-// now we simply force SQLite into "serialized" threading mode
-// (see http://www.sqlite.org/threadsafe.html for details).
+// Use each connection (and its statements, transactions,
+// savepoints, and change feed) from one goroutine at a time;
+// the driver keeps state of its own next to SQLite's that
+// isn't locked. Use separate connections, or a Pool, for
+// separate goroutines. Interrupt() and cancel channels are
+// the exception, they're meant to be used from elsewhere.
+//
+// By default SQLite runs in "serialized" threading mode (see
+// http://www.sqlite.org/threadsafe.html for details), which
+// protects SQLite's own state. Configure() selects another
+// mode before the first connection is opened, and
+// connections opened with OpenNoMutex skip their mutex even
+// in serialized mode.
+//
+// Pools:
+//
+// NewPool() makes a Pool that opens connections as needed,
+// runs a setup function on each new one, and keeps a few
+// idle ones around for reuse. Pool.Get() checks that an idle
+// connection still works before handing it out and waits
+// for one to be put back if MaxOpen connections are in use.
+// For databases in WAL mode, NewRWPool() makes a RWPool with
+// a single writer and several read-only connections;
+// RWPool.Execute() runs queries that only read on a reader
+// and makes everything else wait its turn for the writer.
+// Transactions have to go through RWPool.Write() instead.
 //
 //
 // Low-Level API:
@@ -4,7 +4,10 @@
 
 package sqlite3
 
-import "fmt"
+import (
+	"fmt";
+	"os";
+)
 
 // Error in the database driver itself, *not* the database
 // system we talk to.
@@ -16,6 +19,11 @@ type DriverError struct {
 // Implements os.Error interface.
 func (self DriverError) String() string	{ return self.message }
 
+// Returned by the XYZCancel() variants of operations after
+// their cancel channel fired. Calling Interrupt() directly
+// results in a SystemError with StatusInterrupt instead.
+var ErrCancelled os.Error = &DriverError{"operation cancelled"}
+
 // Basic SQLite status codes as returned by almost
 // every SQLite operation. Note that SQLite calls
 // these "result codes" but we use "Result" for a
@@ -0,0 +1,131 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+import "os"
+
+// A row changed by a committed transaction. Op is one of
+// ActionInsert, ActionUpdate, or ActionDelete.
+type Change struct {
+	Op		int;
+	Database	string;
+	Table		string;
+	RowId		int64;
+}
+
+// Changes made through a connection, delivered on a channel
+// once the transaction making them has committed. Changes
+// from transactions that roll back are never delivered.
+// SQLite doesn't tell us about rolling back to a savepoint,
+// so use Savepoint.Rollback() for that; changes undone by a
+// ROLLBACK TO statement run through Execute() are still
+// delivered when the transaction commits. If nobody receives
+// from the channel and its buffer is full, operations on the
+// connection block until somebody does.
+type ChangeFeed struct {
+	connection	*Connection;
+	changes		chan Change;
+	pending		[]Change;	// of the current transaction
+	committing	bool;		// commit hook ran, outcome unknown
+}
+
+// Start a feed of changes made through this connection, with
+// the given buffer size for the channel. There can only be
+// one feed per connection.
+func (self *Connection) ChangeFeed(buffer int) (feed *ChangeFeed, error os.Error) {
+	if self.feed != nil {
+		error = &DriverError{"ChangeFeed: connection already has a feed!"};
+		return;
+	}
+
+	feed = new(ChangeFeed);
+	feed.connection = self;
+	feed.changes = make(chan Change, buffer);
+	self.feed = feed;
+	self.installHooks();
+	return;
+}
+
+// Channel delivering committed changes. It's closed when
+// the feed or the connection is closed.
+func (self *ChangeFeed) Changes() <-chan Change	{ return self.changes }
+
+// Stop the feed. Changes not committed yet are dropped.
+func (self *ChangeFeed) Close() os.Error {
+	if self.connection == nil {
+		return &DriverError{"Close: feed already closed!"}
+	}
+	conn := self.connection;
+	self.shut();
+	conn.installHooks();
+	return nil;
+}
+
+// Detach from the connection and close the channel.
+func (self *ChangeFeed) shut() {
+	self.connection.feed = nil;
+	self.connection = nil;
+	self.pending = nil;
+	close(self.changes);
+}
+
+// Called from the update hook.
+func (self *ChangeFeed) record(change Change) {
+	n := len(self.pending);
+	if n == cap(self.pending) {
+		s := make([]Change, n, 2*n+8);
+		copy(s, self.pending);
+		self.pending = s;
+	}
+	self.pending = self.pending[0 : n+1];
+	self.pending[n] = change;
+}
+
+// Called from the rollback hook.
+func (self *ChangeFeed) discard() {
+	self.pending = self.pending[0:0];
+	self.committing = false;
+}
+
+// Where the changes recorded for the current transaction
+// end, so we can undo those made after this point.
+func (self *Connection) changeMark() int {
+	if self.feed == nil {
+		return 0
+	}
+	return len(self.feed.pending);
+}
+
+// Drop changes recorded after the mark. SQLite doesn't call
+// the rollback hook for ROLLBACK TO or when a statement
+// fails inside a transaction, so we have to do this for
+// savepoints and failed steps. (Statements using ON
+// CONFLICT FAIL keep the rows changed before the failure;
+// we drop those too.)
+func (self *Connection) undoChanges(mark int) {
+	if self.feed != nil && mark < len(self.feed.pending) {
+		self.feed.pending = self.feed.pending[0:mark]
+	}
+}
+
+// Called after SQLite is done with a step. The commit hook
+// runs *before* the commit actually happens, so only now can
+// we tell if it worked. If it didn't (say the database was
+// busy), the transaction is still active and the changes
+// stay pending.
+func (self *ChangeFeed) settle() {
+	if !self.committing {
+		return
+	}
+	self.committing = false;
+	if self.connection.InTransaction() {
+		return
+	}
+
+	for _, change := range self.pending {
+		self.changes <- change
+	}
+	self.pending = self.pending[0:0];
+}
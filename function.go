@@ -0,0 +1,154 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Go functions callable from SQL, see
+// http://www.sqlite.org/c3ref/create_function.html for
+// details.
+
+import (
+	"fmt";
+	"os";
+)
+
+// Scalar SQL function implemented in Go. Arguments arrive
+// with the same Go types as column values in results: int64,
+// float64, string, []byte, or nil. The result can be of any
+// type accepted as a parameter by Execute(); returning an
+// error (or panicking) makes the SQL statement fail with the
+// error's text.
+type Function func(args []interface{}) (result interface{}, error os.Error)
+
+// Make fn callable from SQL under the given name. It accepts
+// any number of arguments. Deterministic functions always
+// return the same result for the same arguments, which allows
+// SQLite to optimize and to use them in indexes. Passing nil
+// removes a previously registered function.
+func (self *Connection) RegisterFunc(name string, fn Function, deterministic bool) (error os.Error) {
+	flags := sqlUTF8;
+	if deterministic {
+		flags |= sqlDeterministic
+	}
+
+	var rc int;
+	if fn == nil {
+		rc = self.handle.sqlDeleteFunction(name, -1, flags)
+	} else {
+		// if this fails, SQLite releases the id for us
+		rc = self.handle.sqlCreateFunction(name, -1, flags, callbacks.register(fn))
+	}
+
+	if rc != StatusOk {
+		error = self.error()
+	}
+	return;
+}
+
+// Called from SQLite whenever a scalar function runs.
+func callFunction(id int, context *sqlContext, values []*sqlValue) {
+	fn, ok := callbacks.lookup(id).(Function);
+	if !ok {
+		sqlPanic("unknown function")
+	}
+
+	defer recoverResult(context);
+
+	result, error := fn(arguments(values));
+	if error != nil {
+		context.sqlResultError(error.String());
+		return;
+	}
+	setResult(context, result);
+}
+
+// Turn a panic in Go code called from SQLite into an error
+// for the SQL statement; unwinding through C is not an option.
+func recoverResult(context *sqlContext) {
+	if x := recover(); x != nil {
+		context.sqlResultError(fmt.Sprintf("panic: %v", x))
+	}
+}
+
+// Swallow a panic in Go code called from SQLite where there
+// is no way to report an error; unwinding through C is not
+// an option either.
+func recoverCallback()	{ recover() }
+
+// Convert function arguments to Go values, see column()
+// in statement.go for the conversion.
+func arguments(values []*sqlValue) (args []interface{}) {
+	args = make([]interface{}, len(values));
+	for i, v := range values {
+		switch v.sqlValueType() {
+		case sqlIntegerType:
+			args[i] = v.sqlValueInt64()
+		case sqlFloatType:
+			args[i] = v.sqlValueDouble()
+		case sqlTextType:
+			args[i] = v.sqlValueText()
+		case sqlBlobType:
+			args[i] = v.sqlValueBlob()
+		case sqlNullType:
+			args[i] = nil
+		default:
+			sqlPanic("unknown value type")
+		}
+	}
+	return;
+}
+
+// Hand a Go value back to SQLite as the result of a function.
+// The conversion follows bind() in bind.go.
+func setResult(context *sqlContext, result interface{}) {
+	switch v := result.(type) {
+	case nil:
+		context.sqlResultNull()
+	case int:
+		context.sqlResultInt64(int64(v))
+	case int8:
+		context.sqlResultInt64(int64(v))
+	case int16:
+		context.sqlResultInt64(int64(v))
+	case int32:
+		context.sqlResultInt64(int64(v))
+	case int64:
+		context.sqlResultInt64(v)
+	case uint:
+		// as big as uint64 on 64-bit platforms
+		if uint64(v) > maxInt64 {
+			context.sqlResultError("result overflows int64");
+			return;
+		}
+		context.sqlResultInt64(int64(v));
+	case uint8:
+		context.sqlResultInt64(int64(v))
+	case uint16:
+		context.sqlResultInt64(int64(v))
+	case uint32:
+		context.sqlResultInt64(int64(v))
+	case uint64:
+		if v > maxInt64 {
+			context.sqlResultError("result overflows int64");
+			return;
+		}
+		context.sqlResultInt64(int64(v));
+	case float:
+		context.sqlResultDouble(float64(v))
+	case float32:
+		context.sqlResultDouble(float64(v))
+	case float64:
+		context.sqlResultDouble(v)
+	case bool:
+		context.sqlResultInt64(map[bool]int64{true: 1, false: 0}[v])
+	case string:
+		context.sqlResultText(v)
+	case []byte:
+		context.sqlResultBlob(v)
+	case ZeroBlob:
+		context.sqlResultZeroBlob(int(v))
+	default:
+		context.sqlResultError(fmt.Sprintf("can't return result of type %T", result))
+	}
+}
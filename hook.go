@@ -0,0 +1,128 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Notifications about changes, see
+// http://www.sqlite.org/c3ref/update_hook.html and
+// http://www.sqlite.org/c3ref/commit_hook.html for details.
+// Callbacks run while SQLite is in the middle of things and
+// must not use the connection they are registered with. A
+// panic in a callback is swallowed; in OnCommit() it vetoes
+// the commit.
+
+// Call update whenever a row is inserted, updated, or
+// deleted in a rowid table. The op is "INSERT", "UPDATE",
+// or "DELETE"; db is the name of the database, usually
+// "main". Passing nil removes the callback.
+func (self *Connection) OnUpdate(update func(op, db, table string, rowid int64)) {
+	self.onUpdate = update;
+	self.installHooks();
+}
+
+// Call commit whenever a transaction is about to commit.
+// If it returns false, the transaction is rolled back
+// instead. Passing nil removes the callback.
+func (self *Connection) OnCommit(commit func() bool) {
+	self.onCommit = commit;
+	self.installHooks();
+}
+
+// Call rollback whenever a transaction is rolled back,
+// either explicitly or because of an error. Passing nil
+// removes the callback.
+func (self *Connection) OnRollback(rollback func()) {
+	self.onRollback = rollback;
+	self.installHooks();
+}
+
+// Tell SQLite about the hooks we need, both for callbacks
+// and for the change feed, and about those we don't.
+func (self *Connection) installHooks() {
+	if self.onUpdate != nil || self.feed != nil {
+		self.handle.sqlUpdateHook(self.callbackId())
+	} else {
+		self.handle.sqlUpdateHook(0)
+	}
+	if self.onCommit != nil || self.feed != nil {
+		self.handle.sqlCommitHook(self.callbackId())
+	} else {
+		self.handle.sqlCommitHook(0)
+	}
+	if self.onRollback != nil || self.feed != nil {
+		self.handle.sqlRollbackHook(self.callbackId())
+	} else {
+		self.handle.sqlRollbackHook(0)
+	}
+}
+
+// Connection a hook was registered for, nil if it's gone.
+func hookConnection(id int) *Connection {
+	conn, _ := callbacks.lookup(id).(*Connection);
+	return conn;
+}
+
+// What OnUpdate() callbacks get for the actions SQLite
+// passes to the update hook.
+var updateOps = map[int]string{
+	ActionInsert: "INSERT",
+	ActionUpdate: "UPDATE",
+	ActionDelete: "DELETE",
+}
+
+// Called from SQLite for each changed row.
+func updateHook(id int, op int, db, table string, rowid int64) {
+	defer recoverCallback();
+
+	conn := hookConnection(id);
+	if conn == nil {
+		return
+	}
+	if conn.feed != nil {
+		conn.feed.record(Change{op, db, table, rowid})
+	}
+	if conn.onUpdate != nil {
+		conn.onUpdate(updateOps[op], db, table, rowid)
+	}
+}
+
+// Called from SQLite before each commit; returns false to
+// roll back instead.
+func commitHook(id int) (commit bool) {
+	// a panic is as good as a veto
+	defer func() {
+		if x := recover(); x != nil {
+			commit = false
+		}
+	}();
+
+	conn := hookConnection(id);
+	if conn == nil {
+		return true
+	}
+	if conn.onCommit != nil && !conn.onCommit() {
+		// the rollback hook cleans up the feed
+		return false
+	}
+	if conn.feed != nil {
+		conn.feed.committing = true
+	}
+	return true;
+}
+
+// Called from SQLite for each rollback.
+func rollbackHook(id int) {
+	defer recoverCallback();
+
+	conn := hookConnection(id);
+	if conn == nil {
+		return
+	}
+	if conn.feed != nil {
+		conn.feed.discard()
+	}
+	if conn.onRollback != nil {
+		conn.onRollback()
+	}
+}
@@ -6,15 +6,21 @@ package sqlite3
 
 /*
 #include <stdlib.h>
+#include <stdint.h>
+#include <string.h>
 #include <sqlite3.h>
 
+// Everything in here has to be static since we also export Go
+// functions to C (as callbacks) from this file; otherwise cgo
+// ends up with duplicate definitions.
+
 // needed since sqlite3_column_text() and sqlite3_column_name()
 // return const unsigned char* for some wack-a-doodle reason
-const char *wsq_column_text(sqlite3_stmt *statement, int column)
+static const char *wsq_column_text(sqlite3_stmt *statement, int column)
 {
 	return (const char *) sqlite3_column_text(statement, column);
 }
-const char *wsq_column_name(sqlite3_stmt *statement, int column)
+static const char *wsq_column_name(sqlite3_stmt *statement, int column)
 {
         return (const char *) sqlite3_column_name(statement, column);
 }
@@ -22,18 +28,156 @@ const char *wsq_column_name(sqlite3_stmt *statement, int column)
 // needed to work around the void(*)(void*) callback that is the
 // last argument to sqlite3_bind_text(); SQLITE_TRANSIENT forces
 // SQLite to make a private copy of the data
-int wsq_bind_text(sqlite3_stmt *statement, int i, const char* text, int n)
+static int wsq_bind_text(sqlite3_stmt *statement, int i, const char* text, int n)
 {
 	return sqlite3_bind_text(statement, i, text, n, SQLITE_TRANSIENT);
 }
 
+// same as above for sqlite3_bind_blob()
+static int wsq_bind_blob(sqlite3_stmt *statement, int i, const void* data, int n)
+{
+	return sqlite3_bind_blob(statement, i, data, n, SQLITE_TRANSIENT);
+}
+
 // needed to work around the ... argument of sqlite3_config(); if
 // we ever require an option with parameters, we'll have to add more
 // wrappers
-int wsq_config(int option)
+static int wsq_config(int option)
 {
 	return sqlite3_config(option);
 }
+
+// Callbacks implemented in Go, see the //export comments below.
+extern void wsqFunction(sqlite3_context *context, int argc, sqlite3_value **argv);
+extern void wsqRelease(void *id);
+extern void wsqStep(sqlite3_context *context, int argc, sqlite3_value **argv);
+extern void wsqInverse(sqlite3_context *context, int argc, sqlite3_value **argv);
+extern void wsqValue(sqlite3_context *context);
+extern void wsqFinal(sqlite3_context *context);
+extern int wsqCompare(void *id, int na, void *a, int nb, void *b);
+extern void wsqCollationNeeded(void *id, sqlite3 *db, int rep, char *name);
+extern void wsqUpdate(void *id, int op, char *db, char *table, sqlite3_int64 rowid);
+extern int wsqCommit(void *id);
+extern void wsqRollback(void *id);
+extern int wsqTrace(unsigned mask, void *id, void *p, void *x);
+extern int wsqAuthorize(void *id, int action, char *a, char *b, char *db, char *trigger);
+
+// Go functions are registered with an id instead of a pointer;
+// wsqRelease() drops the id once SQLite is done with it.
+static int wsq_create_function(sqlite3 *db, const char *name, int nargs, int flags, uintptr_t id)
+{
+	return sqlite3_create_function_v2(db, name, nargs, flags, (void *) id,
+		wsqFunction, NULL, NULL, wsqRelease);
+}
+static int wsq_create_aggregate(sqlite3 *db, const char *name, int nargs, int flags, uintptr_t id)
+{
+	return sqlite3_create_function_v2(db, name, nargs, flags, (void *) id,
+		NULL, wsqStep, wsqFinal, wsqRelease);
+}
+static int wsq_create_window(sqlite3 *db, const char *name, int nargs, int flags, uintptr_t id)
+{
+	return sqlite3_create_window_function(db, name, nargs, flags, (void *) id,
+		wsqStep, wsqFinal, wsqValue, wsqInverse, wsqRelease);
+}
+static int wsq_delete_function(sqlite3 *db, const char *name, int nargs, int flags)
+{
+	return sqlite3_create_function_v2(db, name, nargs, flags, NULL,
+		NULL, NULL, NULL, NULL);
+}
+
+// cgo can't export functions taking const pointers, so these
+// just cast away the const for the real callbacks in Go
+static int wsq_compare(void *id, int na, const void *a, int nb, const void *b)
+{
+	return wsqCompare(id, na, (void *) a, nb, (void *) b);
+}
+static void wsq_needed(void *id, sqlite3 *db, int rep, const char *name)
+{
+	wsqCollationNeeded(id, db, rep, (char *) name);
+}
+
+// id 0 deletes the collation or the callback
+static int wsq_create_collation(sqlite3 *db, const char *name, uintptr_t id)
+{
+	if (id == 0) {
+		return sqlite3_create_collation_v2(db, name, SQLITE_UTF8,
+			NULL, NULL, NULL);
+	}
+	return sqlite3_create_collation_v2(db, name, SQLITE_UTF8, (void *) id,
+		wsq_compare, wsqRelease);
+}
+static int wsq_collation_needed(sqlite3 *db, uintptr_t id)
+{
+	return sqlite3_collation_needed(db, (void *) id, id == 0 ? NULL : wsq_needed);
+}
+
+static void wsq_update(void *id, int op, const char *db, const char *table, sqlite3_int64 rowid)
+{
+	wsqUpdate(id, op, (char *) db, (char *) table, rowid);
+}
+
+// id 0 removes the hook
+static void wsq_update_hook(sqlite3 *db, uintptr_t id)
+{
+	sqlite3_update_hook(db, id == 0 ? NULL : wsq_update, (void *) id);
+}
+static void wsq_commit_hook(sqlite3 *db, uintptr_t id)
+{
+	sqlite3_commit_hook(db, id == 0 ? NULL : wsqCommit, (void *) id);
+}
+static void wsq_rollback_hook(sqlite3 *db, uintptr_t id)
+{
+	sqlite3_rollback_hook(db, id == 0 ? NULL : wsqRollback, (void *) id);
+}
+
+static int wsq_authorize(void *id, int action, const char *a, const char *b, const char *db, const char *trigger)
+{
+	return wsqAuthorize(id, action, (char *) a, (char *) b, (char *) db, (char *) trigger);
+}
+
+// id 0 removes the authorizer
+static int wsq_set_authorizer(sqlite3 *db, uintptr_t id)
+{
+	return sqlite3_set_authorizer(db, id == 0 ? NULL : wsq_authorize, (void *) id);
+}
+
+// id 0 (or mask 0) removes the trace callback
+static int wsq_trace(sqlite3 *db, unsigned mask, uintptr_t id)
+{
+	return sqlite3_trace_v2(db, mask, id == 0 ? NULL : wsqTrace, (void *) id);
+}
+
+// sqlite3_deserialize() wants memory from sqlite3_malloc64()
+// so it can free (and grow) it later; the copy is made here
+// since we can't hand over Go memory
+static int wsq_deserialize(sqlite3 *db, const char *schema, const void *data, sqlite3_int64 n, int readonly)
+{
+	unsigned char *p = sqlite3_malloc64(n);
+	if (p == NULL) {
+		return SQLITE_NOMEM;
+	}
+	memcpy(p, data, n);
+	unsigned flags = SQLITE_DESERIALIZE_FREEONCLOSE;
+	flags |= readonly ? SQLITE_DESERIALIZE_READONLY : SQLITE_DESERIALIZE_RESIZEABLE;
+	return sqlite3_deserialize(db, schema, p, n, n, flags);
+}
+
+// same as wsq_column_text() for sqlite3_value_text()
+static const char *wsq_value_text(sqlite3_value *value)
+{
+	return (const char *) sqlite3_value_text(value);
+}
+
+// same as wsq_bind_text() for sqlite3_result_text() and
+// sqlite3_result_blob()
+static void wsq_result_text(sqlite3_context *context, const char *text, int n)
+{
+	sqlite3_result_text(context, text, n, SQLITE_TRANSIENT);
+}
+static void wsq_result_blob(sqlite3_context *context, const void *data, int n)
+{
+	sqlite3_result_blob(context, data, n, SQLITE_TRANSIENT);
+}
 */
 import "C"
 import "unsafe"
@@ -48,6 +192,31 @@ const (
 	sqlNullType;
 )
 
+// Event codes for sqlite3_trace_v2().
+const (
+	sqlTraceStmt	= 0x01;
+	sqlTraceProfile	= 0x02;
+	sqlTraceRow	= 0x04;
+	sqlTraceClose	= 0x08;
+)
+
+// Counters for sqlite3_stmt_status().
+const (
+	sqlStmtStatusFullscanStep	= 1;
+	sqlStmtStatusSort		= 2;
+	sqlStmtStatusAutoindex		= 3;
+	sqlStmtStatusVmStep		= 4;
+	sqlStmtStatusReprepare		= 5;
+	sqlStmtStatusRun		= 6;
+	sqlStmtStatusMemUsed		= 99;
+)
+
+// Flags for sqlite3_create_function_v2() and friends.
+const (
+	sqlUTF8			= 1;
+	sqlDeterministic	= 0x800;
+)
+
 // If something goes wrong on this level, we simply bomb
 // out, there's no use trying to recover; note that most
 // calls to sqlPanic() are for things that can never,
@@ -76,6 +245,36 @@ type sqlBlob struct {
 	handle *C.sqlite3_blob;
 }
 
+type sqlBackup struct {
+	handle *C.sqlite3_backup;
+}
+
+type sqlContext struct {
+	handle *C.sqlite3_context;
+}
+
+// Copy n bytes of memory owned by SQLite into a fresh Go
+// slice; SQLite is free to reuse the original as soon as we
+// step or finalize, so we can't hang on to it.
+func goBytes(p unsafe.Pointer, n int) (data []byte) {
+	// we can only view so much of C memory as a Go array
+	// at once, so bigger things are copied in chunks
+	const chunk = 1 << 30;
+	data = make([]byte, n);
+	for i := 0; i < n; i += chunk {
+		m := n - i;
+		if m > chunk {
+			m = chunk
+		}
+		s := (*[chunk]byte)(unsafe.Pointer(uintptr(p) + uintptr(i)));
+		copy(data[i:i+m], s[0:m]);
+	}
+	return;
+}
+
+// largest length a Go slice can have
+const maxInt = int(^uint(0) >> 1)
+
 // Wrappers around the most important SQLite functions.
 
 func sqlConfig(option int) int {
@@ -163,6 +362,19 @@ func (self *sqlConnection) sqlExtendedResultCodes(on bool) int {
 	return int(C.sqlite3_extended_result_codes(self.handle, C.int(v)));
 }
 
+func (self *sqlConnection) sqlInterrupt() {
+	C.sqlite3_interrupt(self.handle);
+}
+
+func (self *sqlConnection) sqlGetAutocommit() bool {
+	return C.sqlite3_get_autocommit(self.handle) != 0;
+}
+
+// Does the connection serialize access with a mutex?
+func (self *sqlConnection) sqlHasMutex() bool {
+	return C.sqlite3_db_mutex(self.handle) != nil
+}
+
 func (self *sqlConnection) sqlErrorMessage() string {
 	cp := C.sqlite3_errmsg(self.handle);
 	if cp == nil {
@@ -189,6 +401,127 @@ func (self *sqlConnection) sqlExtendedErrorCode() int {
 	return int(C.sqlite3_extended_errcode(self.handle));
 }
 
+func (self *sqlConnection) sqlCreateFunction(name string, nargs int, flags int, id int) int {
+	p := C.CString(name);
+	rc := int(C.wsq_create_function(self.handle, p, C.int(nargs), C.int(flags), C.uintptr_t(id)));
+	C.free(unsafe.Pointer(p));
+	return rc;
+}
+
+func (self *sqlConnection) sqlCreateAggregate(name string, nargs int, flags int, id int) int {
+	p := C.CString(name);
+	rc := int(C.wsq_create_aggregate(self.handle, p, C.int(nargs), C.int(flags), C.uintptr_t(id)));
+	C.free(unsafe.Pointer(p));
+	return rc;
+}
+
+func (self *sqlConnection) sqlCreateWindow(name string, nargs int, flags int, id int) int {
+	p := C.CString(name);
+	rc := int(C.wsq_create_window(self.handle, p, C.int(nargs), C.int(flags), C.uintptr_t(id)));
+	C.free(unsafe.Pointer(p));
+	return rc;
+}
+
+func (self *sqlConnection) sqlDeleteFunction(name string, nargs int, flags int) int {
+	p := C.CString(name);
+	rc := int(C.wsq_delete_function(self.handle, p, C.int(nargs), C.int(flags)));
+	C.free(unsafe.Pointer(p));
+	return rc;
+}
+
+func (self *sqlConnection) sqlCreateCollation(name string, id int) int {
+	p := C.CString(name);
+	rc := int(C.wsq_create_collation(self.handle, p, C.uintptr_t(id)));
+	C.free(unsafe.Pointer(p));
+	return rc;
+}
+
+func (self *sqlConnection) sqlCollationNeeded(id int) int {
+	return int(C.wsq_collation_needed(self.handle, C.uintptr_t(id)));
+}
+
+func (self *sqlConnection) sqlBlobOpen(db, table, column string, rowid int64, writable bool) (blob *sqlBlob, rc int) {
+	blob = new(sqlBlob);
+
+	d := C.CString(db);
+	t := C.CString(table);
+	c := C.CString(column);
+	w := map[bool]int{true: 1, false: 0}[writable];
+	rc = int(C.sqlite3_blob_open(self.handle, d, t, c, C.sqlite3_int64(rowid), C.int(w), &blob.handle));
+	C.free(unsafe.Pointer(c));
+	C.free(unsafe.Pointer(t));
+	C.free(unsafe.Pointer(d));
+
+	// Older versions of SQLite leave the handle alone on
+	// error, so we make sure we don't return garbage.
+	if rc != StatusOk {
+		blob = nil
+	}
+
+	return;
+}
+
+// Note that errors end up in the destination connection.
+func (self *sqlConnection) sqlBackupInit(destName string, source *sqlConnection, sourceName string) (backup *sqlBackup) {
+	d := C.CString(destName);
+	s := C.CString(sourceName);
+	handle := C.sqlite3_backup_init(self.handle, d, source.handle, s);
+	C.free(unsafe.Pointer(s));
+	C.free(unsafe.Pointer(d));
+
+	if handle != nil {
+		backup = &sqlBackup{handle}
+	}
+	return;
+}
+
+// Returns nil data if SQLite can't serialize the database
+// (for example because there is no such schema) or if it
+// doesn't fit into a Go slice; size tells which.
+func (self *sqlConnection) sqlSerialize(schema string) (data []byte, size int64) {
+	p := C.CString(schema);
+	var n C.sqlite3_int64;
+	q := C.sqlite3_serialize(self.handle, p, &n, 0);
+	C.free(unsafe.Pointer(p));
+
+	if q != nil {
+		size = int64(n);
+		if size <= int64(maxInt) {
+			data = goBytes(unsafe.Pointer(q), int(n))
+		}
+		C.sqlite3_free(unsafe.Pointer(q));
+	}
+	return;
+}
+
+func (self *sqlConnection) sqlDeserialize(schema string, data []byte, readOnly bool) int {
+	p := C.CString(schema);
+	r := map[bool]int{true: 1, false: 0}[readOnly];
+	rc := int(C.wsq_deserialize(self.handle, p, unsafe.Pointer(&data[0]), C.sqlite3_int64(len(data)), C.int(r)));
+	C.free(unsafe.Pointer(p));
+	return rc;
+}
+
+func (self *sqlConnection) sqlUpdateHook(id int) {
+	C.wsq_update_hook(self.handle, C.uintptr_t(id));
+}
+
+func (self *sqlConnection) sqlCommitHook(id int) {
+	C.wsq_commit_hook(self.handle, C.uintptr_t(id));
+}
+
+func (self *sqlConnection) sqlRollbackHook(id int) {
+	C.wsq_rollback_hook(self.handle, C.uintptr_t(id));
+}
+
+func (self *sqlConnection) sqlSetAuthorizer(id int) int {
+	return int(C.wsq_set_authorizer(self.handle, C.uintptr_t(id)));
+}
+
+func (self *sqlConnection) sqlTrace(mask int, id int) int {
+	return int(C.wsq_trace(self.handle, C.uint(mask), C.uintptr_t(id)));
+}
+
 func (self *sqlConnection) sqlPrepare(query string) (stat *sqlStatement, rc int) {
 	stat = new(sqlStatement);
 
@@ -219,6 +552,22 @@ func (self *sqlStatement) sqlBindParameterCount() int {
 	return int(C.sqlite3_bind_parameter_count(self.handle));
 }
 
+func (self *sqlStatement) sqlBindParameterName(slot int) string {
+	cp := C.sqlite3_bind_parameter_name(self.handle, C.int(slot+1));
+	// Nameless "?" slots return nil, so no sanity checks;
+	// we simply turn them into empty strings.
+	return C.GoString(cp);
+}
+
+func (self *sqlStatement) sqlBindParameterIndex(name string) int {
+	p := C.CString(name);
+	// SQLite returns 0 if there's no such parameter, which
+	// conveniently becomes -1 for us.
+	slot := int(C.sqlite3_bind_parameter_index(self.handle, p)) - 1;
+	C.free(unsafe.Pointer(p));
+	return slot;
+}
+
 func (self *sqlStatement) sqlBindText(slot int, value string) int {
 	p := C.CString(value);
 	// SQLite counts slots from 1 instead of 0; -1 means "until
@@ -228,6 +577,32 @@ func (self *sqlStatement) sqlBindText(slot int, value string) int {
 	return rc;
 }
 
+func (self *sqlStatement) sqlBindBlob(slot int, value []byte) int {
+	if len(value) == 0 {
+		// a nil pointer would bind NULL instead of an
+		// empty BLOB
+		return self.sqlBindZeroBlob(slot, 0)
+	}
+	p := unsafe.Pointer(&value[0]);
+	return int(C.wsq_bind_blob(self.handle, C.int(slot+1), p, C.int(len(value))));
+}
+
+func (self *sqlStatement) sqlBindInt64(slot int, value int64) int {
+	return int(C.sqlite3_bind_int64(self.handle, C.int(slot+1), C.sqlite3_int64(value)));
+}
+
+func (self *sqlStatement) sqlBindDouble(slot int, value float64) int {
+	return int(C.sqlite3_bind_double(self.handle, C.int(slot+1), C.double(value)));
+}
+
+func (self *sqlStatement) sqlBindNull(slot int) int {
+	return int(C.sqlite3_bind_null(self.handle, C.int(slot+1)));
+}
+
+func (self *sqlStatement) sqlBindZeroBlob(slot int, size int) int {
+	return int(C.sqlite3_bind_zeroblob(self.handle, C.int(slot+1), C.int(size)));
+}
+
 func (self *sqlStatement) sqlStep() int {
 	return int(C.sqlite3_step(self.handle));
 }
@@ -242,6 +617,34 @@ func (self *sqlStatement) sqlSql() string {
 	return C.GoString(cp);
 }
 
+func (self *sqlStatement) sqlExpandedSql() (sql string) {
+	cp := C.sqlite3_expanded_sql(self.handle);
+	// This returns nil if we're out of memory or the
+	// result would be too long; we make do with "".
+	if cp != nil {
+		sql = C.GoString(cp);
+		C.sqlite3_free(unsafe.Pointer(cp));
+	}
+	return;
+}
+
+func (self *sqlStatement) sqlStatus(counter int, reset bool) int {
+	r := map[bool]int{true: 1, false: 0}[reset];
+	return int(C.sqlite3_stmt_status(self.handle, C.int(counter), C.int(r)));
+}
+
+// True if the statement doesn't write to the database
+// directly; see sqlite3_stmt_readonly() for the fine print.
+func (self *sqlStatement) sqlReadOnly() bool {
+	return C.sqlite3_stmt_readonly(self.handle) != 0
+}
+
+// Identifies the underlying statement, even across separate
+// wrappers for it.
+func (self *sqlStatement) sqlKey() uintptr {
+	return uintptr(unsafe.Pointer(self.handle));
+}
+
 func (self *sqlStatement) sqlFinalize() int {
 	return int(C.sqlite3_finalize(self.handle));
 }
@@ -283,6 +686,23 @@ func (self *sqlStatement) sqlColumnText(col int) string {
 	return C.GoString(cp);
 }
 
+func (self *sqlStatement) sqlColumnInt64(col int) int64 {
+	return int64(C.sqlite3_column_int64(self.handle, C.int(col)));
+}
+
+func (self *sqlStatement) sqlColumnDouble(col int) float64 {
+	return float64(C.sqlite3_column_double(self.handle, C.int(col)));
+}
+
+func (self *sqlStatement) sqlColumnBlob(col int) []byte {
+	// The order matters: sqlite3_column_bytes() has to be
+	// called *after* sqlite3_column_blob(), otherwise we
+	// may get the size of some other representation.
+	p := C.sqlite3_column_blob(self.handle, C.int(col));
+	n := int(C.sqlite3_column_bytes(self.handle, C.int(col)));
+	return goBytes(unsafe.Pointer(p), n);
+}
+
 func (self *sqlStatement) sqlColumnDeclaredType(col int) string {
 	cp := C.sqlite3_column_decltype(self.handle, C.int(col));
 	// This can return nil, for example if the column is an
@@ -290,3 +710,243 @@ func (self *sqlStatement) sqlColumnDeclaredType(col int) string {
 	// again no sanity checks...
 	return C.GoString(cp);
 }
+
+// Wrappers as blob methods.
+
+func (self *sqlBlob) sqlBlobClose() int {
+	return int(C.sqlite3_blob_close(self.handle));
+}
+
+func (self *sqlBlob) sqlBlobBytes() int {
+	return int(C.sqlite3_blob_bytes(self.handle));
+}
+
+func (self *sqlBlob) sqlBlobRead(data []byte, offset int) int {
+	if len(data) == 0 {
+		return StatusOk
+	}
+	p := unsafe.Pointer(&data[0]);
+	return int(C.sqlite3_blob_read(self.handle, p, C.int(len(data)), C.int(offset)));
+}
+
+func (self *sqlBlob) sqlBlobWrite(data []byte, offset int) int {
+	if len(data) == 0 {
+		return StatusOk
+	}
+	p := unsafe.Pointer(&data[0]);
+	return int(C.sqlite3_blob_write(self.handle, p, C.int(len(data)), C.int(offset)));
+}
+
+func (self *sqlBlob) sqlBlobReopen(rowid int64) int {
+	return int(C.sqlite3_blob_reopen(self.handle, C.sqlite3_int64(rowid)));
+}
+
+// Wrappers as backup methods.
+
+func (self *sqlBackup) sqlBackupStep(pages int) int {
+	return int(C.sqlite3_backup_step(self.handle, C.int(pages)));
+}
+
+func (self *sqlBackup) sqlBackupRemaining() int {
+	return int(C.sqlite3_backup_remaining(self.handle));
+}
+
+func (self *sqlBackup) sqlBackupPageCount() int {
+	return int(C.sqlite3_backup_pagecount(self.handle));
+}
+
+func (self *sqlBackup) sqlBackupFinish() int {
+	return int(C.sqlite3_backup_finish(self.handle));
+}
+
+// Wrappers as value methods.
+
+func (self *sqlValue) sqlValueType() int {
+	return int(C.sqlite3_value_type(self.handle));
+}
+
+func (self *sqlValue) sqlValueInt64() int64 {
+	return int64(C.sqlite3_value_int64(self.handle));
+}
+
+func (self *sqlValue) sqlValueDouble() float64 {
+	return float64(C.sqlite3_value_double(self.handle));
+}
+
+func (self *sqlValue) sqlValueText() string {
+	return C.GoString(C.wsq_value_text(self.handle));
+}
+
+func (self *sqlValue) sqlValueBlob() []byte {
+	// same order as for sqlColumnBlob()
+	p := C.sqlite3_value_blob(self.handle);
+	n := int(C.sqlite3_value_bytes(self.handle));
+	return goBytes(unsafe.Pointer(p), n);
+}
+
+// Wrappers as context methods.
+
+func (self *sqlContext) sqlResultNull() {
+	C.sqlite3_result_null(self.handle);
+}
+
+func (self *sqlContext) sqlResultInt64(value int64) {
+	C.sqlite3_result_int64(self.handle, C.sqlite3_int64(value));
+}
+
+func (self *sqlContext) sqlResultDouble(value float64) {
+	C.sqlite3_result_double(self.handle, C.double(value));
+}
+
+func (self *sqlContext) sqlResultText(value string) {
+	p := C.CString(value);
+	C.wsq_result_text(self.handle, p, C.int(-1));
+	C.free(unsafe.Pointer(p));
+}
+
+func (self *sqlContext) sqlResultBlob(value []byte) {
+	if len(value) == 0 {
+		// a nil pointer would result in NULL
+		C.sqlite3_result_zeroblob(self.handle, 0);
+		return;
+	}
+	C.wsq_result_blob(self.handle, unsafe.Pointer(&value[0]), C.int(len(value)));
+}
+
+func (self *sqlContext) sqlResultZeroBlob(size int) {
+	C.sqlite3_result_zeroblob(self.handle, C.int(size));
+}
+
+func (self *sqlContext) sqlResultError(message string) {
+	p := C.CString(message);
+	// SQLite makes a private copy of the message
+	C.sqlite3_result_error(self.handle, p, C.int(-1));
+	C.free(unsafe.Pointer(p));
+}
+
+func (self *sqlContext) sqlUserData() int {
+	return int(uintptr(C.sqlite3_user_data(self.handle)));
+}
+
+// Per-group memory for aggregates, zeroed by SQLite when
+// first allocated and freed after the final call. We only
+// keep an id there. Returns nil if we're out of memory.
+func (self *sqlContext) sqlAggregateContext() *uintptr {
+	var id uintptr;
+	p := C.sqlite3_aggregate_context(self.handle, C.int(unsafe.Sizeof(id)));
+	return (*uintptr)(p);
+}
+
+func (self *sqlContext) sqlResultNoMem() {
+	C.sqlite3_result_error_nomem(self.handle);
+}
+
+// Turn the argv array SQLite passes to callbacks into
+// a slice of value wrappers.
+func sqlValues(argc C.int, argv **C.sqlite3_value) (values []*sqlValue) {
+	n := int(argc);
+	values = make([]*sqlValue, n);
+	if n > 0 {
+		a := (*[1 << 20]*C.sqlite3_value)(unsafe.Pointer(argv));
+		for i := 0; i < n; i++ {
+			values[i] = &sqlValue{a[i]}
+		}
+	}
+	return;
+}
+
+// Callbacks from C into Go. These only unwrap arguments,
+// the real work happens in the Go files.
+
+//export wsqFunction
+func wsqFunction(context *C.sqlite3_context, argc C.int, argv **C.sqlite3_value) {
+	c := &sqlContext{context};
+	callFunction(c.sqlUserData(), c, sqlValues(argc, argv));
+}
+
+//export wsqRelease
+func wsqRelease(id unsafe.Pointer) {
+	callbacks.unregister(int(uintptr(id)));
+}
+
+//export wsqStep
+func wsqStep(context *C.sqlite3_context, argc C.int, argv **C.sqlite3_value) {
+	c := &sqlContext{context};
+	stepAggregate(c.sqlUserData(), c, sqlValues(argc, argv), false);
+}
+
+//export wsqInverse
+func wsqInverse(context *C.sqlite3_context, argc C.int, argv **C.sqlite3_value) {
+	c := &sqlContext{context};
+	stepAggregate(c.sqlUserData(), c, sqlValues(argc, argv), true);
+}
+
+//export wsqValue
+func wsqValue(context *C.sqlite3_context) {
+	c := &sqlContext{context};
+	finishAggregate(c.sqlUserData(), c, false);
+}
+
+//export wsqFinal
+func wsqFinal(context *C.sqlite3_context) {
+	c := &sqlContext{context};
+	finishAggregate(c.sqlUserData(), c, true);
+}
+
+//export wsqCompare
+func wsqCompare(id unsafe.Pointer, na C.int, a unsafe.Pointer, nb C.int, b unsafe.Pointer) C.int {
+	x := string(goBytes(a, int(na)));
+	y := string(goBytes(b, int(nb)));
+	return C.int(callCollation(int(uintptr(id)), x, y));
+}
+
+//export wsqCollationNeeded
+func wsqCollationNeeded(id unsafe.Pointer, db *C.sqlite3, rep C.int, name *C.char) {
+	collationNeeded(int(uintptr(id)), C.GoString(name));
+}
+
+//export wsqUpdate
+func wsqUpdate(id unsafe.Pointer, op C.int, db *C.char, table *C.char, rowid C.sqlite3_int64) {
+	updateHook(int(uintptr(id)), int(op), C.GoString(db), C.GoString(table), int64(rowid));
+}
+
+//export wsqCommit
+func wsqCommit(id unsafe.Pointer) C.int {
+	// non-zero turns the commit into a rollback
+	return C.int(map[bool]int{true: 0, false: 1}[commitHook(int(uintptr(id)))]);
+}
+
+//export wsqRollback
+func wsqRollback(id unsafe.Pointer) {
+	rollbackHook(int(uintptr(id)));
+}
+
+//export wsqAuthorize
+func wsqAuthorize(id unsafe.Pointer, action C.int, a *C.char, b *C.char, db *C.char, trigger *C.char) C.int {
+	// GoString() turns missing arguments (nil) into ""
+	return C.int(authorize(int(uintptr(id)), int(action), C.GoString(a), C.GoString(b), C.GoString(db), C.GoString(trigger)));
+}
+
+//export wsqTrace
+func wsqTrace(mask C.uint, id unsafe.Pointer, p unsafe.Pointer, x unsafe.Pointer) C.int {
+	var stmt *sqlStatement;
+	var nanoseconds int64;
+	var text string;
+
+	event := int(mask);
+	switch event {
+	case sqlTraceStmt:
+		// SQL text, or a comment naming the trigger
+		stmt = &sqlStatement{(*C.sqlite3_stmt)(p)};
+		text = C.GoString((*C.char)(x));
+	case sqlTraceRow:
+		stmt = &sqlStatement{(*C.sqlite3_stmt)(p)}
+	case sqlTraceProfile:
+		stmt = &sqlStatement{(*C.sqlite3_stmt)(p)};
+		nanoseconds = int64(*(*C.sqlite3_int64)(x));
+	}
+
+	trace(int(uintptr(id)), event, stmt, text, nanoseconds);
+	// the return value is ignored by SQLite
+	return 0;
+}
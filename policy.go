@@ -0,0 +1,134 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+import (
+	"fmt";
+	"os";
+	"strings";
+)
+
+// A ready-made authorizer for running untrusted queries.
+// Only SELECT statements (including WITH RECURSIVE) are
+// allowed; writes, schema changes, transactions, ATTACH,
+// and PRAGMA are all denied. Names are matched without
+// regard to case.
+type ReadOnlyPolicy struct {
+	// Tables (and views) that may be read; nil allows
+	// all of them. Listing a view allows reading the
+	// tables behind it through that view.
+	Tables	[]string;
+	// Columns that may be read, by table; tables without
+	// an entry allow all their columns. This applies to
+	// reads through views as well.
+	Columns	map[string][]string;
+	// Functions that may not be called.
+	DeniedFunctions	[]string;
+}
+
+// Policy with its names lowered for lookup.
+type policy struct {
+	tables		map[string]bool;	// nil allows all
+	columns		map[string]map[string]bool;
+	functions	map[string]bool;
+}
+
+// Enforce the policy for all statements prepared from now
+// on. Statements it denies fail to prepare with a DriverError
+// naming the reason. This replaces any authorizer set with
+// SetAuthorizer(); passing nil removes the policy.
+func (self *Connection) SetPolicy(readOnly *ReadOnlyPolicy) (error os.Error) {
+	if readOnly == nil {
+		return self.SetAuthorizer(nil)
+	}
+
+	p := readOnly.compile();
+	return self.SetAuthorizer(func(action int, arg1, arg2, db, trigger string) int {
+		reason := p.check(action, arg1, arg2, trigger);
+		if len(reason) > 0 {
+			self.denial = reason;
+			return AuthDeny;
+		}
+		return AuthOk;
+	});
+}
+
+func lowerSet(names []string) (set map[string]bool) {
+	set = make(map[string]bool, len(names));
+	for _, name := range names {
+		set[strings.ToLower(name)] = true
+	}
+	return;
+}
+
+// Copy the policy so later changes don't affect connections
+// that already use it.
+func (self *ReadOnlyPolicy) compile() (p *policy) {
+	p = new(policy);
+	if self.Tables != nil {
+		p.tables = lowerSet(self.Tables)
+	}
+	p.columns = make(map[string]map[string]bool, len(self.Columns));
+	for table, columns := range self.Columns {
+		p.columns[strings.ToLower(table)] = lowerSet(columns)
+	}
+	p.functions = lowerSet(self.DeniedFunctions);
+	return;
+}
+
+func (self *policy) tableAllowed(table string) bool {
+	if self.tables == nil {
+		return true
+	}
+	_, ok := self.tables[strings.ToLower(table)];
+	return ok;
+}
+
+// Was the view (or trigger) named explicitly? If Tables is
+// nil, it wasn't.
+func (self *policy) viewListed(view string) bool {
+	if self.tables == nil || len(view) == 0 {
+		return false
+	}
+	_, ok := self.tables[strings.ToLower(view)];
+	return ok;
+}
+
+// Reason for denying the action, "" if it's allowed.
+func (self *policy) check(action int, arg1, arg2, trigger string) string {
+	switch action {
+	case ActionSelect, ActionRecursive:
+		return ""
+	case ActionRead:
+		// reads through a listed view are fine even if
+		// the table isn't, but columns are checked anyway
+		if !self.viewListed(trigger) && !self.tableAllowed(arg1) {
+			return fmt.Sprintf("access to table %s denied by policy", arg1)
+		}
+		columns, ok := self.columns[strings.ToLower(arg1)];
+		if ok && len(arg2) > 0 {
+			if _, ok = columns[strings.ToLower(arg2)]; !ok {
+				return fmt.Sprintf("access to column %s.%s denied by policy", arg1, arg2)
+			}
+		}
+		return "";
+	case ActionFunction:
+		if _, ok := self.functions[strings.ToLower(arg2)]; ok {
+			return fmt.Sprintf("call to function %s denied by policy", arg2)
+		}
+		return "";
+	case ActionInsert, ActionUpdate, ActionDelete:
+		return fmt.Sprintf("write to table %s denied by policy", arg1)
+	case ActionPragma:
+		return fmt.Sprintf("PRAGMA %s denied by policy", arg1)
+	case ActionAttach:
+		return "ATTACH denied by policy"
+	case ActionDetach:
+		return "DETACH denied by policy"
+	case ActionTransaction, ActionSavepoint:
+		return "transaction control denied by policy"
+	}
+	return fmt.Sprintf("schema change (action %d) denied by policy", action);
+}
@@ -0,0 +1,260 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+import (
+	"os";
+	"sync";
+	"time";
+)
+
+// How a Pool opens and manages its connections.
+type PoolConfig struct {
+	// How to open new connections
+	Open	*OpenConfig;
+	// Most connections open at once, in use or idle;
+	// 0 means no limit
+	MaxOpen	int;
+	// Most idle connections kept around for reuse; 0 means
+	// the default of 2, negative values mean none
+	MaxIdle	int;
+	// Nanoseconds after which a connection is closed
+	// instead of reused; 0 means no limit
+	MaxLifetime	int64;
+	// Called for each new connection, for example to
+	// register functions; an error discards the connection
+	Setup	func(*Connection) os.Error;
+}
+
+// A set of connections to the same database that can be
+// reused instead of opening a fresh one each time. Get()
+// a connection, use it from one goroutine, and Put() it
+// back when done.
+type Pool struct {
+	config	PoolConfig;
+	// one token per connection we may open, nil if there's
+	// no limit
+	tokens	chan bool;
+	lock	sync.Mutex;	// protects the fields below
+	idle	[]*Connection;	// most recently used last
+	born	map[*Connection]int64;	// when opened, for all connections
+	out	map[*Connection]bool;	// handed out by Get()
+	stuck	[]*Connection;	// failed to close, try again later
+	closed	bool;
+}
+
+// idle connections kept if PoolConfig doesn't say
+const defaultMaxIdle = 2
+
+// Make a pool; connections are opened as needed.
+func NewPool(config *PoolConfig) (pool *Pool, error os.Error) {
+	if config.Open == nil {
+		error = &DriverError{"NewPool: no OpenConfig"};
+		return;
+	}
+	error = config.Open.check();
+	if error != nil {
+		return
+	}
+
+	pool = new(Pool);
+	pool.config = *config;
+	pool.born = make(map[*Connection]int64);
+	pool.out = make(map[*Connection]bool);
+	if pool.config.MaxIdle == 0 {
+		pool.config.MaxIdle = defaultMaxIdle
+	}
+	if config.MaxOpen > 0 {
+		pool.tokens = make(chan bool, config.MaxOpen);
+		for i := 0; i < config.MaxOpen; i++ {
+			pool.tokens <- true
+		}
+	}
+	return;
+}
+
+// Get a connection, reusing an idle one if possible. If
+// MaxOpen connections are in use, wait for one to be put
+// back; the wait ends with ErrCancelled if cancel fires
+// first. Once the wait is over, cancel is ignored; opening
+// a new connection and running Setup can't be cancelled.
+func (self *Pool) Get(cancel <-chan bool) (conn *Connection, error os.Error) {
+	if self.tokens != nil {
+		if cancel == nil {
+			_ = <-self.tokens
+		} else {
+			select {
+			case _ = <-self.tokens:
+			case _ = <-cancel:
+				error = ErrCancelled;
+				return;
+			}
+		}
+	}
+
+	for {
+		self.lock.Lock();
+		if self.closed {
+			self.lock.Unlock();
+			self.release();
+			error = &DriverError{"Get: pool closed!"};
+			return;
+		}
+		n := len(self.idle);
+		if n == 0 {
+			self.lock.Unlock();
+			break;
+		}
+		conn = self.idle[n-1];
+		self.idle[n-1] = nil;
+		self.idle = self.idle[0 : n-1];
+		self.out[conn] = true;
+		self.lock.Unlock();
+
+		if !self.expired(conn) && healthy(conn) {
+			return
+		}
+		self.discard(conn);
+	}
+
+	conn, error = self.open();
+	if error != nil {
+		conn = nil;
+		self.release();
+	}
+	return;
+}
+
+// Give a connection back to the pool. Connections with an
+// active transaction are closed instead of being reused, so
+// are old connections and those beyond MaxIdle. Putting back
+// a connection that didn't come from Get() (or putting it
+// back twice) is an error.
+func (self *Pool) Put(conn *Connection) (error os.Error) {
+	self.lock.Lock();
+	_, ok := self.out[conn];
+	self.out[conn] = false, false;
+	self.lock.Unlock();
+	if !ok {
+		return &DriverError{"Put: connection not from this pool or already put back!"}
+	}
+
+	fresh := !self.expired(conn) && !conn.InTransaction();
+
+	self.lock.Lock();
+	keep := fresh && !self.closed && len(self.idle) < self.config.MaxIdle;
+	if keep {
+		self.idle = appendConnection(self.idle, conn)
+	}
+	self.lock.Unlock();
+
+	if !keep {
+		error = self.discard(conn)
+	}
+	self.release();
+	return;
+}
+
+// Close all idle connections, and try again for those that
+// failed to close earlier; connections still in use are
+// closed when they are put back.
+func (self *Pool) Close() (error os.Error) {
+	self.lock.Lock();
+	idle := self.idle;
+	for _, conn := range self.stuck {
+		idle = appendConnection(idle, conn)
+	}
+	self.idle = nil;
+	self.stuck = nil;
+	self.closed = true;
+	self.lock.Unlock();
+
+	for _, conn := range idle {
+		e := self.discard(conn);
+		if error == nil {
+			error = e
+		}
+	}
+	return;
+}
+
+// Open and set up a new connection.
+func (self *Pool) open() (conn *Connection, error os.Error) {
+	conn, error = OpenWithConfig(self.config.Open);
+	if error != nil {
+		return
+	}
+	if self.config.Setup != nil {
+		error = self.config.Setup(conn);
+		if error != nil {
+			// ignore potential secondary error
+			_ = conn.Close();
+			return;
+		}
+	}
+
+	self.lock.Lock();
+	self.born[conn] = time.Nanoseconds();
+	self.out[conn] = true;
+	self.lock.Unlock();
+	return;
+}
+
+// Close a connection we won't reuse. If that fails (say the
+// caller left statements open), we hang on to it and try
+// again in Close() instead of leaking its handle.
+func (self *Pool) discard(conn *Connection) (error os.Error) {
+	self.lock.Lock();
+	self.out[conn] = false, false;
+	self.lock.Unlock();
+
+	error = conn.Close();
+
+	self.lock.Lock();
+	if error == nil {
+		self.born[conn] = 0, false
+	} else {
+		self.stuck = appendConnection(self.stuck, conn)
+	}
+	self.lock.Unlock();
+	return;
+}
+
+// Let somebody else open a connection.
+func (self *Pool) release() {
+	if self.tokens != nil {
+		// we took a token before, so there's room
+		self.tokens <- true
+	}
+}
+
+// Has the connection outlived MaxLifetime?
+func (self *Pool) expired(conn *Connection) bool {
+	if self.config.MaxLifetime <= 0 {
+		return false
+	}
+	self.lock.Lock();
+	born, ok := self.born[conn];
+	self.lock.Unlock();
+	return !ok || time.Nanoseconds()-born > self.config.MaxLifetime;
+}
+
+func appendConnection(s []*Connection, conn *Connection) []*Connection {
+	n := len(s);
+	if n == cap(s) {
+		t := make([]*Connection, n, 2*n+4);
+		copy(t, s);
+		s = t;
+	}
+	s = s[0 : n+1];
+	s[n] = conn;
+	return s;
+}
+
+// Cheap check that a connection still works and is not in
+// the middle of a transaction.
+func healthy(conn *Connection) bool {
+	return !conn.InTransaction() && conn.exec("SELECT 1") == nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+import "sync"
+
+// Callbacks from SQLite need to find their way back to Go
+// values (functions, connections, ...). We can't hand Go
+// pointers to C, so we hand out integer ids instead and
+// look them up here. Ids start at 1; 0 means "none".
+type registry struct {
+	lock	sync.Mutex;
+	next	int;
+	entries	map[int]interface{};
+}
+
+var callbacks = &registry{entries: make(map[int]interface{})}
+
+func (self *registry) register(value interface{}) (id int) {
+	self.lock.Lock();
+	self.next++;
+	id = self.next;
+	self.entries[id] = value;
+	self.lock.Unlock();
+	return;
+}
+
+// Value for id, nil if there is none.
+func (self *registry) lookup(id int) (value interface{}) {
+	self.lock.Lock();
+	value, _ = self.entries[id];
+	self.lock.Unlock();
+	return;
+}
+
+func (self *registry) unregister(id int) {
+	self.lock.Lock();
+	self.entries[id] = nil, false;
+	self.lock.Unlock();
+}
@@ -0,0 +1,259 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+import (
+	"os";
+	"strings";
+	"sync";
+)
+
+// How a RWPool opens its connections.
+type RWPoolConfig struct {
+	// How to open connections; the flags are adjusted for
+	// the writer and the readers
+	Open	*OpenConfig;
+	// Number of reader connections, at least 1
+	Readers	int;
+	// Called for each new connection, the writer as well as
+	// the readers
+	Setup	func(*Connection) os.Error;
+}
+
+// A pool for databases in WAL mode: one writer connection
+// that goroutines take turns with, and several readers
+// that run alongside it. Writes through a single
+// connection wait for each other in Go instead of fighting
+// over the database lock and failing with StatusBusy.
+// Readers are separate connections, so they can't see TEMP
+// tables (or anything else private) created on the writer.
+type RWPool struct {
+	lock	sync.Mutex;	// serializes use of the writer
+	writer	*Connection;
+	readers	*Pool;
+}
+
+// Make a read/write pool. The writer is opened right away
+// and switches the database to WAL mode; readers are
+// opened as needed.
+func NewRWPool(config *RWPoolConfig) (pool *RWPool, error os.Error) {
+	if config.Open == nil {
+		error = &DriverError{"NewRWPool: no OpenConfig"};
+		return;
+	}
+	if config.Readers < 1 {
+		error = &DriverError{"NewRWPool: need at least one reader"};
+		return;
+	}
+
+	w := *config.Open;
+	w.Flags = w.Flags&^OpenReadOnly | OpenReadWrite;
+	w.Pragmas = make([]Pragma, len(config.Open.Pragmas)+1);
+	copy(w.Pragmas, config.Open.Pragmas);
+	w.Pragmas[len(w.Pragmas)-1] = Pragma{"journal_mode", "wal"};
+
+	// journal mode is stored in the database, readers can't
+	// and needn't set it
+	r := *config.Open;
+	r.Flags = r.Flags&^(OpenReadWrite|OpenCreate) | OpenReadOnly;
+	r.Pragmas = nil;
+	for _, p := range config.Open.Pragmas {
+		if strings.ToLower(p.Name) != "journal_mode" {
+			r.Pragmas = appendPragma(r.Pragmas, p)
+		}
+	}
+
+	pool = new(RWPool);
+	pool.writer, error = OpenWithConfig(&w);
+	if error != nil {
+		pool = nil;
+		return;
+	}
+	if config.Setup != nil {
+		error = config.Setup(pool.writer);
+		if error != nil {
+			// ignore potential secondary error
+			_ = pool.writer.Close();
+			pool = nil;
+			return;
+		}
+	}
+
+	pool.readers, error = NewPool(&PoolConfig{
+		Open: &r,
+		MaxOpen: config.Readers,
+		MaxIdle: config.Readers,
+		Setup: config.Setup,
+	});
+	if error != nil {
+		// ignore potential secondary error
+		_ = pool.writer.Close();
+		pool = nil;
+	}
+	return;
+}
+
+// Run a query and return all its results. Queries that
+// only read run on a reader connection, everything else
+// waits for the writer. Statements that obviously write
+// (INSERT, UPDATE, DELETE, and schema changes) go straight
+// to the writer; others are prepared on a reader first to
+// ask SQLite, and prepared again on the writer if they turn
+// out to write. Transaction control and ATTACH or DETACH
+// would leave connection state behind for the next caller,
+// so they fail here; use Write() instead.
+func (self *RWPool) Execute(query string, parameters ...) (data [][]interface{}, error os.Error) {
+	return self.ExecuteCancel(nil, query, parameters)
+}
+
+// Same as Execute() but gives up with ErrCancelled once the
+// cancel channel fires, including while waiting for a
+// reader.
+func (self *RWPool) ExecuteCancel(cancel <-chan bool, query string, parameters ...) (data [][]interface{}, error os.Error) {
+	switch firstKeyword(query) {
+	case "BEGIN", "COMMIT", "END", "ROLLBACK", "SAVEPOINT", "RELEASE", "ATTACH", "DETACH":
+		error = &DriverError{"Execute: transactions and ATTACH/DETACH need Write()!"};
+		return;
+	case "INSERT", "UPDATE", "DELETE", "REPLACE", "CREATE", "DROP", "ALTER":
+		return self.write(cancel, query, parameters)
+	}
+
+	conn, error := self.readers.Get(cancel);
+	if error != nil {
+		return
+	}
+	st, error := conn.PrepareCancel(cancel, query);
+	if error != nil {
+		self.readers.Put(conn);
+		return;
+	}
+	s := st.(*Statement);
+
+	if s.handle.sqlReadOnly() {
+		data, error = collect(cancel, conn, s, parameters);
+		// any error from close is secondary
+		_ = s.Close();
+		self.readers.Put(conn);
+		return;
+	}
+
+	// prepared on the wrong connection, do it again
+	_ = s.Close();
+	self.readers.Put(conn);
+	return self.write(cancel, query, parameters);
+}
+
+// Run a query on the writer once it's our turn.
+func (self *RWPool) write(cancel <-chan bool, query string, parameters ...) (data [][]interface{}, error os.Error) {
+	self.lock.Lock();
+	defer self.lock.Unlock();
+
+	st, error := self.writer.PrepareCancel(cancel, query);
+	if error != nil {
+		return
+	}
+	s := st.(*Statement);
+	data, error = collect(cancel, self.writer, s, parameters);
+	// any error from close is secondary
+	_ = s.Close();
+	return;
+}
+
+// Call f with the writer connection, for example to run a
+// transaction. Nobody else writes until f returns; the
+// connection must not be used after that.
+func (self *RWPool) Write(f func(*Connection) os.Error) os.Error {
+	self.lock.Lock();
+	defer self.lock.Unlock();
+	return f(self.writer);
+}
+
+// Call f with a reader connection. The connection must not
+// be used after f returns.
+func (self *RWPool) Read(cancel <-chan bool, f func(*Connection) os.Error) (error os.Error) {
+	conn, error := self.readers.Get(cancel);
+	if error != nil {
+		return
+	}
+	error = f(conn);
+	self.readers.Put(conn);
+	return;
+}
+
+// Close the writer and all idle readers.
+func (self *RWPool) Close() (error os.Error) {
+	self.lock.Lock();
+	error = self.writer.Close();
+	self.lock.Unlock();
+	if e := self.readers.Close(); error == nil {
+		error = e
+	}
+	return;
+}
+
+// Execute a statement and gather all of its results.
+func collect(cancel <-chan bool, conn *Connection, s *Statement, parameters ...) (data [][]interface{}, error os.Error) {
+	rs, error := conn.ExecuteClassicCancel(cancel, s, parameters);
+	if error != nil || rs == nil {
+		return
+	}
+	crs := rs.(*ClassicResultSet);
+	for crs.More() {
+		r := crs.FetchCancel(cancel);
+		if error = r.Error(); error != nil {
+			return
+		}
+		n := len(data);
+		if n == cap(data) {
+			d := make([][]interface{}, n, 2*n+4);
+			copy(d, data);
+			data = d;
+		}
+		data = data[0 : n+1];
+		data[n] = r.Data();
+	}
+	return;
+}
+
+// First keyword of a query in upper case, skipping white
+// space and comments.
+func firstKeyword(query string) string {
+	i := 0;
+	for i < len(query) {
+		switch {
+		case isSpace(query[i]):
+			i++
+		case strings.HasPrefix(query[i:len(query)], "--"):
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(query[i:len(query)], "/*"):
+			end := strings.Index(query[i+2:len(query)], "*/");
+			if end < 0 {
+				return ""
+			}
+			i += end + 4;
+		default:
+			j := i;
+			for j < len(query) && isWordChar(query[j]) {
+				j++
+			}
+			return strings.ToUpper(query[i:j]);
+		}
+	}
+	return "";
+}
+
+func appendPragma(s []Pragma, p Pragma) []Pragma {
+	n := len(s);
+	if n == cap(s) {
+		t := make([]Pragma, n, 2*n+4);
+		copy(t, s);
+		s = t;
+	}
+	s = s[0 : n+1];
+	s[n] = p;
+	return s;
+}
@@ -0,0 +1,59 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Databases as plain bytes, see
+// http://www.sqlite.org/c3ref/serialize.html and
+// http://www.sqlite.org/c3ref/deserialize.html for details.
+
+import (
+	"fmt";
+	"os";
+)
+
+// SQLite 3.23.0 introduced sqlite3_serialize() and friends,
+// see http://www.sqlite.org/changes.html for details.
+const serializeVersion = 3023000
+
+// Copy of the given database (usually "main") in the same
+// format as a database file.
+func (self *Connection) Serialize(schema string) (data []byte, error os.Error) {
+	if sqlVersionNumber() < serializeVersion {
+		error = &DriverError{"Serialize: SQLite 3.23.0 or later required!"};
+		return;
+	}
+
+	var size int64;
+	data, size = self.handle.sqlSerialize(schema);
+	switch {
+	case size > int64(maxInt):
+		error = &DriverError{fmt.Sprintf("Serialize: database %s too big (%d bytes)", schema, size)}
+	case data == nil:
+		error = &DriverError{fmt.Sprintf("Serialize: can't serialize database %s", schema)}
+	}
+	return;
+}
+
+// Replace the given database (usually "main") with an
+// in-memory copy of data as returned from Serialize().
+// Changes to the database never make it back to data or to
+// the file the database was opened from. A readOnly
+// database can't be changed at all.
+func (self *Connection) Deserialize(schema string, data []byte, readOnly bool) (error os.Error) {
+	if sqlVersionNumber() < serializeVersion {
+		error = &DriverError{"Deserialize: SQLite 3.23.0 or later required!"};
+		return;
+	}
+	if len(data) == 0 {
+		error = &DriverError{"Deserialize: no data"};
+		return;
+	}
+
+	rc := self.handle.sqlDeserialize(schema, data, readOnly);
+	if rc != StatusOk {
+		error = self.error()
+	}
+	return;
+}
@@ -16,10 +16,13 @@ type ResultSet struct {
 	results chan db.Result;
 	// channel to check for termination
 	stops chan bool;
+	// channel to cancel fetching, may be nil
+	cancel <-chan bool;
 }
 
-func (self *ResultSet) init(crs db.ClassicResultSet) {
+func (self *ResultSet) init(crs db.ClassicResultSet, cancel <-chan bool) {
 	self.classic = crs;
+	self.cancel = cancel;
 	self.results = make(chan db.Result);
 	self.stops = make(chan bool);
 }
@@ -33,12 +36,19 @@ func (self *ResultSet) kill() {
 	self.stops = nil;
 }
 
+func (self *ResultSet) fetch() db.Result {
+	if crs, ok := self.classic.(*ClassicResultSet); ok {
+		return crs.FetchCancel(self.cancel)
+	}
+	return self.classic.Fetch();
+}
+
 // goroutine implementing the iterator
 func (self *ResultSet) iterate() {
 	for self.classic.More() {
 		// block until either send or receive
 		select {
-		case self.results <- self.classic.Fetch():
+		case self.results <- self.fetch():
 //			fmt.Printf("sent to %s", self.results);
 		case _ = <-self.stops:
 //			fmt.Printf("received from %s", self.stops);
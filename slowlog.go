@@ -0,0 +1,145 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+import (
+	"bytes";
+	"os";
+)
+
+// A statement that ran longer than the slow query log's
+// threshold.
+type SlowQuery struct {
+	// SQL with whitespace collapsed and literals
+	// replaced by "?"
+	SQL	string;
+	// Nanoseconds the statement took
+	Duration	int64;
+	// Rows the statement produced
+	Rows	int;
+	// Counters for this run of the statement only
+	Stats	StatementStats;
+}
+
+type slowLog struct {
+	threshold	int64;
+	sink		func(SlowQuery);
+	runs		map[uintptr]*slowRun;	// by statement
+}
+
+// A statement that is still running.
+type slowRun struct {
+	rows	int;
+	start	StatementStats;
+}
+
+// Report every statement that takes at least threshold
+// nanoseconds to sink. Like trace callbacks, sink must not
+// use the connection. Passing nil turns the log off.
+func (self *Connection) SetSlowQueryLog(threshold int64, sink func(SlowQuery)) (error os.Error) {
+	// same requirement as SetTrace()
+	if sqlVersionNumber() < 3014000 {
+		error = &DriverError{"SetSlowQueryLog: SQLite 3.14.0 or later required!"};
+		return;
+	}
+
+	if sink == nil {
+		self.slowLog = nil
+	} else {
+		l := new(slowLog);
+		l.threshold = threshold;
+		l.sink = sink;
+		l.runs = make(map[uintptr]*slowRun);
+		self.slowLog = l;
+	}
+	return self.installTrace();
+}
+
+// Called for each traced event concerning a statement.
+func (self *slowLog) trace(event int, stmt *sqlStatement, nanoseconds int64) {
+	key := stmt.sqlKey();
+	run, ok := self.runs[key];
+
+	switch event {
+	case TraceStatement:
+		// triggers report in again, we only care
+		// about the first time
+		if !ok {
+			self.runs[key] = &slowRun{0, statementStats(stmt, false)}
+		}
+	case TraceRow:
+		if ok {
+			run.rows++
+		}
+	case TraceProfile:
+		self.runs[key] = nil, false;
+		if nanoseconds < self.threshold {
+			return
+		}
+
+		q := SlowQuery{SQL: normalizeSQL(stmt.sqlSql()), Duration: nanoseconds};
+		q.Stats = statementStats(stmt, false);
+		if ok {
+			q.Rows = run.rows;
+			q.Stats = q.Stats.since(run.start);
+		}
+		self.sink(q);
+	}
+}
+
+func isSpace(c byte) bool	{ return c == ' ' || c == '\t' || c == '\n' || c == '\r' }
+
+func isWordChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || isDigit(c) || c == '_'
+}
+
+// Collapse whitespace and replace string and number literals
+// with "?" so that queries differing only in their constants
+// look the same.
+func normalizeSQL(sql string) string {
+	var b bytes.Buffer;
+	var last byte;	// last byte written
+	space := false;
+
+	for i := 0; i < len(sql); {
+		c := sql[i];
+		if isSpace(c) {
+			space = true;
+			i++;
+			continue;
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ');
+			last = ' ';
+		}
+		space = false;
+
+		switch {
+		case c == '\'':
+			// '' inside a literal is an escaped '
+			for i++; i < len(sql); i++ {
+				if sql[i] == '\'' {
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						i++;
+						continue;
+					}
+					break;
+				}
+			}
+			i++;
+			c = '?';
+		case isDigit(c) && !isWordChar(last):
+			for i < len(sql) && (isWordChar(sql[i]) || sql[i] == '.') {
+				i++
+			}
+			c = '?';
+		default:
+			i++
+		}
+		b.WriteByte(c);
+		last = c;
+	}
+	return b.String();
+}
@@ -31,10 +31,52 @@ func (self *Statement) Close() (error os.Error) {
 	return;
 }
 
+// Take the next step in executing the statement. If the
+// cancel channel fires while we're at it, the statement is
+// interrupted and ErrCancelled returned.
+func (self *Statement) step(cancel <-chan bool) (rc int, error os.Error) {
+	w := self.connection.watch(cancel);
+	if w.cancelled() {
+		return StatusInterrupt, ErrCancelled
+	}
+
+	mark := self.connection.changeMark();
+	rc = self.handle.sqlStep();
+	cancelled := w.stop();
+	if rc != StatusDone && rc != StatusRow {
+		self.connection.undoChanges(mark)
+	}
+
+	// The interrupt may have come in after SQLite was done
+	// with this step. If the statement finished, it really
+	// happened (and may have committed), so we report success.
+	// If it produced a row, we stop there and reset it. Either
+	// way the interrupt stays pending; SQLite clears it when
+	// the next statement starts with no other statement
+	// running on the connection.
+	switch {
+	case cancelled && rc == StatusRow:
+		_ = self.handle.sqlReset();
+		self.connection.stepped();
+		return StatusInterrupt, ErrCancelled;
+	case cancelled && rc&0xff == StatusInterrupt:
+		self.connection.stepped();
+		return rc, ErrCancelled;
+	}
+	self.connection.stepped();
+
+	if rc != StatusDone && rc != StatusRow {
+		// presumably any other outcome is an error
+		error = self.connection.error()
+	}
+	return;
+}
+
 // Make the statement ready for re-binding parameters
 // and re-execution.
 func (self *Statement) clear() (error os.Error) {
 	rc := self.handle.sqlReset();
+	self.connection.stepped();
 	if rc == StatusOk {
 		rc := self.handle.sqlClearBindings();
 		if rc == StatusOk {
@@ -44,3 +86,25 @@ func (self *Statement) clear() (error os.Error) {
 	error = self.connection.error();
 	return;
 }
+
+// Value of the given column in the current row, converted
+// to the closest Go type: INTEGER becomes int64, REAL
+// becomes float64, TEXT becomes string, BLOB becomes
+// []byte, and NULL becomes nil.
+func (self *Statement) column(col int) (value interface{}) {
+	switch self.handle.sqlColumnType(col) {
+	case sqlIntegerType:
+		value = self.handle.sqlColumnInt64(col)
+	case sqlFloatType:
+		value = self.handle.sqlColumnDouble(col)
+	case sqlTextType:
+		value = self.handle.sqlColumnText(col)
+	case sqlBlobType:
+		value = self.handle.sqlColumnBlob(col)
+	case sqlNullType:
+		value = nil
+	default:
+		sqlPanic("unknown column type")
+	}
+	return;
+}
@@ -0,0 +1,54 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Performance counters of a statement, see
+// http://www.sqlite.org/c3ref/c_stmtstatus_counter.html
+// for details. Except for MemoryUsed, these count up from
+// when the statement was prepared or last reset.
+type StatementStats struct {
+	FullScanSteps	int;	// steps in full table scans
+	Sorts		int;	// sort operations
+	AutoIndexSteps	int;	// rows inserted into automatic indexes
+	VMSteps		int;	// virtual machine operations
+	Reprepares	int;	// automatic re-preparations
+	Runs		int;	// completed runs
+	MemoryUsed	int;	// bytes used by the statement
+}
+
+// Performance counters of the statement. If reset is true,
+// the counters start again from zero afterwards. Useful to
+// make sure queries use indexes instead of full scans.
+func (self *Statement) Stats(reset bool) StatementStats {
+	return statementStats(self.handle, reset)
+}
+
+// Current counters of a statement, reset to zero if asked
+// to (except for MemoryUsed).
+func statementStats(stmt *sqlStatement, reset bool) (stats StatementStats) {
+	stats.FullScanSteps = stmt.sqlStatus(sqlStmtStatusFullscanStep, reset);
+	stats.Sorts = stmt.sqlStatus(sqlStmtStatusSort, reset);
+	stats.AutoIndexSteps = stmt.sqlStatus(sqlStmtStatusAutoindex, reset);
+	stats.VMSteps = stmt.sqlStatus(sqlStmtStatusVmStep, reset);
+	// SQLite 3.20.0 introduced the remaining counters,
+	// see http://www.sqlite.org/changes.html for details.
+	if sqlVersionNumber() >= 3020000 {
+		stats.Reprepares = stmt.sqlStatus(sqlStmtStatusReprepare, reset);
+		stats.Runs = stmt.sqlStatus(sqlStmtStatusRun, reset);
+		stats.MemoryUsed = stmt.sqlStatus(sqlStmtStatusMemUsed, false);
+	}
+	return;
+}
+
+// Counters accumulated since an earlier snapshot.
+func (self StatementStats) since(earlier StatementStats) StatementStats {
+	self.FullScanSteps -= earlier.FullScanSteps;
+	self.Sorts -= earlier.Sorts;
+	self.AutoIndexSteps -= earlier.AutoIndexSteps;
+	self.VMSteps -= earlier.VMSteps;
+	self.Reprepares -= earlier.Reprepares;
+	self.Runs -= earlier.Runs;
+	return self;
+}
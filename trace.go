@@ -0,0 +1,113 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+// Tracing what SQLite does, see
+// http://www.sqlite.org/c3ref/trace_v2.html for details.
+
+import (
+	"os";
+	"strings";
+)
+
+// Events that can be traced, or'd together for SetTrace().
+const (
+	TraceStatement	= 0x01;	// statement starts running
+	TraceProfile	= 0x02;	// statement finished running
+	TraceRow	= 0x04;	// statement produced a row
+	TraceClose	= 0x08;	// connection is closing
+)
+
+// A single traced event. Type is one of the TraceXYZ
+// constants.
+type TraceEvent struct {
+	Type	int;
+	// SQL of the statement, except for TraceClose
+	SQL	string;
+	// SQL with parameters filled in, TraceStatement only
+	ExpandedSQL	string;
+	// Name of the trigger starting to run, TraceStatement
+	// only; SQL is still the statement that fired it
+	Trigger	string;
+	// Nanoseconds the statement took, TraceProfile only
+	Duration	int64;
+}
+
+// Call trace for the events selected by mask. Just like
+// hooks, trace must not use the connection, and panics in
+// it are swallowed. A mask of 0 or passing nil removes the
+// callback.
+func (self *Connection) SetTrace(mask int, trace func(TraceEvent)) (error os.Error) {
+	// SQLite 3.14.0 introduced sqlite3_trace_v2(), see
+	// http://www.sqlite.org/changes.html for details.
+	if sqlVersionNumber() < 3014000 {
+		error = &DriverError{"SetTrace: SQLite 3.14.0 or later required!"};
+		return;
+	}
+
+	if trace == nil {
+		mask = 0
+	}
+	self.tracer = trace;
+	self.traceMask = mask;
+	return self.installTrace();
+}
+
+// Tell SQLite about the events we need, both for SetTrace()
+// and for the slow query log.
+func (self *Connection) installTrace() (error os.Error) {
+	mask := 0;
+	if self.tracer != nil {
+		mask |= self.traceMask
+	}
+	if self.slowLog != nil {
+		mask |= TraceStatement | TraceProfile | TraceRow
+	}
+
+	id := 0;
+	if mask != 0 {
+		id = self.callbackId()
+	}
+
+	rc := self.handle.sqlTrace(mask, id);
+	if rc != StatusOk {
+		error = self.error()
+	}
+	return;
+}
+
+// Called from SQLite for each traced event; stmt is nil
+// for TraceClose, text is only there for TraceStatement.
+func trace(id int, event int, stmt *sqlStatement, text string, nanoseconds int64) {
+	defer recoverCallback();
+
+	conn, _ := callbacks.lookup(id).(*Connection);
+	if conn == nil {
+		return
+	}
+	if conn.slowLog != nil && stmt != nil {
+		conn.slowLog.trace(event, stmt, nanoseconds)
+	}
+	if conn.tracer == nil || conn.traceMask&event == 0 {
+		return
+	}
+
+	e := TraceEvent{Type: event, Duration: nanoseconds};
+	if stmt != nil {
+		e.SQL = stmt.sqlSql()
+	}
+	if event == TraceStatement {
+		// Triggers come as "-- TRIGGER name" instead of the
+		// statement's SQL; statements starting with their
+		// own comment still come with their SQL.
+		const prefix = "-- TRIGGER ";
+		if text != e.SQL && strings.HasPrefix(text, prefix) {
+			e.Trigger = text[len(prefix):len(text)]
+		} else {
+			e.ExpandedSQL = stmt.sqlExpandedSql()
+		}
+	}
+	conn.tracer(e);
+}
@@ -0,0 +1,237 @@
+// Copyright 2009 Peter H. Froehlich. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlite3
+
+import (
+	"fmt";
+	"os";
+)
+
+// These constants select how Begin() acquires locks, see
+// http://www.sqlite.org/lang_transaction.html for details.
+const (
+	TransactionDeferred	= iota;	// lock on first access
+	TransactionImmediate;		// reserved lock right away
+	TransactionExclusive;		// exclusive lock right away
+)
+
+var transactionStatements = []string{
+	"BEGIN DEFERRED",
+	"BEGIN IMMEDIATE",
+	"BEGIN EXCLUSIVE",
+}
+
+// SQLite transactions. SQLite doesn't nest transactions,
+// so there can only be one active Transaction for each
+// Connection at a time.
+type Transaction struct {
+	connection	*Connection;
+	done		bool;	// committed or rolled back
+}
+
+// Does the connection have an active transaction? Note
+// that this also reports transactions started by hand
+// using "BEGIN" statements.
+func (self *Connection) InTransaction() bool {
+	return !self.handle.sqlGetAutocommit()
+}
+
+// Start a transaction using the given TransactionXYZ
+// mode.
+func (self *Connection) Begin(mode int) (transaction *Transaction, error os.Error) {
+	if mode < 0 || mode >= len(transactionStatements) {
+		error = &DriverError{"Begin: unknown transaction mode!"};
+		return;
+	}
+	if self.InTransaction() {
+		error = &DriverError{"Begin: transaction already active!"};
+		return;
+	}
+
+	error = self.exec(transactionStatements[mode]);
+	if error != nil {
+		return
+	}
+
+	transaction = &Transaction{self, false};
+	return;
+}
+
+// Run body inside a transaction. If body returns an error,
+// the transaction is rolled back and that error returned;
+// otherwise the transaction is committed.
+func (self *Connection) Transact(mode int, body func(*Transaction) os.Error) (error os.Error) {
+	transaction, error := self.Begin(mode);
+	if error != nil {
+		return
+	}
+
+	error = body(transaction);
+	if error != nil {
+		// the original error is more interesting than
+		// any secondary one from rolling back
+		_ = transaction.Rollback();
+		return;
+	}
+
+	return transaction.Commit();
+}
+
+// Make the changes of the transaction permanent. If that
+// fails, the transaction is rolled back so the connection
+// is not stuck with a half-finished transaction.
+func (self *Transaction) Commit() (error os.Error) {
+	if self.done {
+		error = &DriverError{"Commit: transaction already finished!"};
+		return;
+	}
+	self.done = true;
+
+	// SQLite rolls back on its own after some errors,
+	// see http://www.sqlite.org/c3ref/get_autocommit.html
+	if !self.connection.InTransaction() {
+		self.connection.dropSavepoints();
+		error = &DriverError{"Commit: no active transaction, already rolled back?"};
+		return;
+	}
+
+	error = self.connection.exec("COMMIT");
+	if error != nil && self.connection.InTransaction() {
+		// ignore potential secondary error
+		_ = self.connection.exec("ROLLBACK")
+	}
+	self.connection.dropSavepoints();
+	return;
+}
+
+// Discard the changes of the transaction. It's fine to
+// call Rollback() after SQLite rolled back on its own.
+func (self *Transaction) Rollback() (error os.Error) {
+	if self.done {
+		error = &DriverError{"Rollback: transaction already finished!"};
+		return;
+	}
+	self.done = true;
+
+	if self.connection.InTransaction() {
+		error = self.connection.exec("ROLLBACK")
+	}
+	self.connection.dropSavepoints();
+	return;
+}
+
+// Savepoints work like nested transactions, see
+// http://www.sqlite.org/lang_savepoint.html for details.
+// They can be used with or without an enclosing
+// Transaction; without one, releasing the outermost
+// Savepoint commits.
+type Savepoint struct {
+	connection	*Connection;
+	name		string;
+	done		bool;	// released or rolled back
+	mark		int;	// changes pending in the feed before us
+}
+
+// Start a savepoint with a name unique to this connection.
+// Savepoints must be released or rolled back in reverse
+// order of creation.
+func (self *Connection) Savepoint() (savepoint *Savepoint, error os.Error) {
+	self.savepointCount++;
+	name := fmt.Sprintf("sqlite3_savepoint_%d", self.savepointCount);
+
+	error = self.exec("SAVEPOINT " + name);
+	if error != nil {
+		return
+	}
+
+	savepoint = &Savepoint{self, name, false, self.changeMark()};
+	self.pushSavepoint(savepoint);
+	return;
+}
+
+// Name used for the savepoint in SQL.
+func (self *Savepoint) String() string	{ return self.name }
+
+// Keep the changes made since the savepoint started. They
+// become permanent once the enclosing transaction commits.
+func (self *Savepoint) Release() (error os.Error) {
+	error = self.check("Release");
+	if error != nil {
+		return
+	}
+
+	error = self.connection.exec("RELEASE " + self.name);
+	if error != nil {
+		return
+	}
+	self.connection.popSavepoint();
+	return;
+}
+
+// Discard the changes made since the savepoint started.
+// The enclosing transaction, if any, stays active.
+func (self *Savepoint) Rollback() (error os.Error) {
+	error = self.check("Rollback");
+	if error != nil {
+		return
+	}
+
+	error = self.connection.exec("ROLLBACK TO " + self.name);
+	if error != nil {
+		return
+	}
+	// before RELEASE, which may commit what's left
+	self.connection.undoChanges(self.mark);
+	// ROLLBACK TO leaves the savepoint in place
+	error = self.connection.exec("RELEASE " + self.name);
+	if error != nil {
+		return
+	}
+	self.connection.popSavepoint();
+	return;
+}
+
+// Make sure the savepoint is still active and innermost.
+func (self *Savepoint) check(op string) (error os.Error) {
+	if self.done {
+		return &DriverError{op + ": savepoint already finished!"}
+	}
+	if !self.connection.InTransaction() {
+		// whatever held the savepoints is gone
+		self.connection.dropSavepoints();
+		return &DriverError{op + ": no active transaction, already rolled back?"};
+	}
+	n := len(self.connection.savepoints);
+	if self.connection.savepoints[n-1] != self {
+		return &DriverError{fmt.Sprintf("%s: savepoint %s is not the innermost one!", op, self.name)}
+	}
+	return;
+}
+
+func (self *Connection) pushSavepoint(savepoint *Savepoint) {
+	n := len(self.savepoints);
+	if n == cap(self.savepoints) {
+		s := make([]*Savepoint, n, 2*n+4);
+		copy(s, self.savepoints);
+		self.savepoints = s;
+	}
+	self.savepoints = self.savepoints[0 : n+1];
+	self.savepoints[n] = savepoint;
+}
+
+func (self *Connection) popSavepoint() {
+	n := len(self.savepoints);
+	self.savepoints[n-1].done = true;
+	self.savepoints[n-1] = nil;
+	self.savepoints = self.savepoints[0 : n-1];
+}
+
+// Forget all savepoints after the transaction holding
+// them finished.
+func (self *Connection) dropSavepoints() {
+	for len(self.savepoints) > 0 {
+		self.popSavepoint()
+	}
+}
@@ -10,5 +10,6 @@ import "fmt"
 // flags into the "flags=123456789" notation required for
 // the URL passed to Open(). It's a shame that we have to
 // go from int to string and back to int, but thus is the
-// price of generality.
+// price of generality. See OpenWithConfig() for a way to
+// avoid URLs altogether.
 func FlagsURL(options int) string	{ return fmt.Sprintf("flags=%d", options) }